@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
+
+	"github.com/sean-/go-sharded-cluster-keys/key32"
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+	"github.com/sean-/go-sharded-cluster-keys/keybits"
+	"github.com/sean-/go-sharded-cluster-keys/keyuuid"
+)
+
+// shardKey adapts the key32, key64 and keyuuid encoders to one 128-bit
+// word type so the subcommands can treat every width alike.
+type shardKey interface {
+	Bits() int
+	PrefixSize() int
+	PrefixHexSize() int
+	Describe() string
+
+	Parse(s string) (keybits.Uint128, error)
+	Format(w keybits.Uint128) string
+
+	Encode(w keybits.Uint128) keybits.Uint128
+	Decode(w keybits.Uint128) keybits.Uint128
+	Prefix(encoded keybits.Uint128) uint64
+}
+
+var errInput = errors.New("unrecognized key")
+
+// newShardKey builds a shardKey for the given layout; format selects the
+// output form ("decimal", "hex", "base32" for integers; "uuid" or "ulid"
+// for 128-bit keys).
+func newShardKey(width, total, offset, size int, format string) (shardKey, error) {
+	switch width {
+	case 32:
+		enc, err := key32.NewEncoderE(offset, size)
+		if err != nil {
+			return nil, err
+		}
+		f, err := intFormat(format, key32.Decimal, key32.Hex, key32.Base32)
+		if err != nil {
+			return nil, err
+		}
+		return int32Key{enc: enc, text: key32.NewTextCodec(enc, f), formatted: format != ""}, nil
+	case 64:
+		enc, err := key64.NewEncoderE(offset, size)
+		if err != nil {
+			return nil, err
+		}
+		f, err := intFormat(format, key64.Decimal, key64.Hex, key64.Base32)
+		if err != nil {
+			return nil, err
+		}
+		return int64Key{enc: enc, text: key64.NewTextCodec(enc, f), formatted: format != ""}, nil
+	case 128:
+		enc, err := keyuuid.NewEncoderE(total, offset, size)
+		if err != nil {
+			return nil, err
+		}
+		switch format {
+		case "", "uuid", "ulid":
+		default:
+			return nil, fmt.Errorf("format %q is not valid for 128-bit keys (want uuid or ulid)", format)
+		}
+		return uuidKey{enc: enc, total: total, offset: offset, ulid: format == "ulid"}, nil
+	}
+	return nil, fmt.Errorf("width must be 32, 64 or 128, got %d", width)
+}
+
+func intFormat[F ~int](format string, dec, hex, b32 F) (F, error) {
+	switch format {
+	case "", "decimal":
+		return dec, nil
+	case "hex":
+		return hex, nil
+	case "base32":
+		return b32, nil
+	}
+	return dec, fmt.Errorf("format %q is not valid for integer keys (want decimal, hex or base32)", format)
+}
+
+// parseUint accepts 0x-prefixed hex and, unless -format was given,
+// decimal.  With -format, integer keys are otherwise read only in that
+// notation, so all-digit hex or base32 text is never mistaken for decimal.
+func parseUint(s string, bits int, formatted bool) (uint64, error) {
+	if h, ok := strings.CutPrefix(strings.ToLower(s), "0x"); ok {
+		return strconv.ParseUint(h, 16, bits)
+	}
+	if formatted {
+		return 0, fmt.Errorf("%w %q", errInput, s)
+	}
+	return strconv.ParseUint(s, 10, bits)
+}
+
+type int32Key struct {
+	enc       key32.Encoder
+	text      key32.TextCodec
+	formatted bool // -format was given: parse in that notation
+}
+
+func (k int32Key) Bits() int          { return 32 }
+func (k int32Key) PrefixSize() int    { return k.enc.PrefixSize() }
+func (k int32Key) PrefixHexSize() int { return k.enc.PrefixHexSize() }
+func (k int32Key) Describe() string {
+	return fmt.Sprintf("width=32 offset=%d size=%d", k.enc.LeftSize(), k.enc.PrefixSize())
+}
+
+func (k int32Key) Parse(s string) (keybits.Uint128, error) {
+	if v, err := parseUint(s, 32, k.formatted); err == nil {
+		return keybits.Uint128From(v), nil
+	}
+	if k.formatted {
+		if v, err := k.text.Parse(s); err == nil {
+			return keybits.Uint128From(uint64(v)), nil
+		}
+	}
+	return keybits.Uint128{}, fmt.Errorf("%w %q", errInput, s)
+}
+
+func (k int32Key) Format(w keybits.Uint128) string { return k.text.Format(key32.Value(w.Lo)) }
+func (k int32Key) Encode(w keybits.Uint128) keybits.Uint128 {
+	return keybits.Uint128From(uint64(k.enc.Encode(uint32(w.Lo))))
+}
+func (k int32Key) Decode(w keybits.Uint128) keybits.Uint128 {
+	return keybits.Uint128From(uint64(k.enc.Decode(key32.Value(w.Lo))))
+}
+func (k int32Key) Prefix(w keybits.Uint128) uint64 { return uint64(k.enc.Prefix(key32.Value(w.Lo))) }
+
+type int64Key struct {
+	enc       key64.Encoder
+	text      key64.TextCodec
+	formatted bool // -format was given: parse in that notation
+}
+
+func (k int64Key) Bits() int          { return 64 }
+func (k int64Key) PrefixSize() int    { return k.enc.PrefixSize() }
+func (k int64Key) PrefixHexSize() int { return k.enc.PrefixHexSize() }
+func (k int64Key) Describe() string {
+	return fmt.Sprintf("width=64 offset=%d size=%d", k.enc.LeftSize(), k.enc.PrefixSize())
+}
+
+func (k int64Key) Parse(s string) (keybits.Uint128, error) {
+	if v, err := parseUint(s, 64, k.formatted); err == nil {
+		return keybits.Uint128From(v), nil
+	}
+	if k.formatted {
+		if v, err := k.text.Parse(s); err == nil {
+			return keybits.Uint128From(uint64(v)), nil
+		}
+	}
+	return keybits.Uint128{}, fmt.Errorf("%w %q", errInput, s)
+}
+
+func (k int64Key) Format(w keybits.Uint128) string { return k.text.Format(key64.Value(w.Lo)) }
+func (k int64Key) Encode(w keybits.Uint128) keybits.Uint128 {
+	return keybits.Uint128From(uint64(k.enc.Encode(w.Lo)))
+}
+func (k int64Key) Decode(w keybits.Uint128) keybits.Uint128 {
+	return keybits.Uint128From(k.enc.Decode(key64.Value(w.Lo)))
+}
+func (k int64Key) Prefix(w keybits.Uint128) uint64 { return k.enc.Prefix(key64.Value(w.Lo)) }
+
+type uuidKey struct {
+	enc    keyuuid.Encoder
+	total  int
+	offset int
+	ulid   bool
+}
+
+func (k uuidKey) Bits() int          { return 128 }
+func (k uuidKey) PrefixSize() int    { return k.enc.PrefixSize() }
+func (k uuidKey) PrefixHexSize() int { return (k.enc.PrefixSize() + 3) / 4 }
+func (k uuidKey) Describe() string {
+	return fmt.Sprintf("width=128 total=%d offset=%d size=%d", k.total, k.offset, k.enc.PrefixSize())
+}
+
+// Parse accepts UUIDs in any form uuid.Parse does, and ULIDs.
+func (k uuidKey) Parse(s string) (keybits.Uint128, error) {
+	if len(s) == ulid.EncodedSize {
+		u, err := ulid.ParseStrict(s)
+		if err != nil {
+			return keybits.Uint128{}, fmt.Errorf("%w %q: %v", errInput, s, err)
+		}
+		return keybits.Uint128FromBytes(u), nil
+	}
+	u, err := uuid.Parse(s)
+	if err != nil {
+		return keybits.Uint128{}, fmt.Errorf("%w %q: %v", errInput, s, err)
+	}
+	return keybits.Uint128FromBytes(u), nil
+}
+
+func (k uuidKey) Format(w keybits.Uint128) string {
+	if k.ulid {
+		return ulid.ULID(w.Bytes()).String()
+	}
+	return uuid.UUID(w.Bytes()).String()
+}
+
+func (k uuidKey) Encode(w keybits.Uint128) keybits.Uint128 {
+	return keybits.Uint128FromBytes(k.enc.Encode(w.Bytes()))
+}
+func (k uuidKey) Decode(w keybits.Uint128) keybits.Uint128 {
+	return keybits.Uint128FromBytes(k.enc.Decode(w.Bytes()))
+}
+func (k uuidKey) Prefix(w keybits.Uint128) uint64 { return k.enc.PrefixBits(w.Bytes()) }
+
+// decimal renders w in base 10.
+func decimal(w keybits.Uint128) string {
+	if w.Hi == 0 {
+		return strconv.FormatUint(w.Lo, 10)
+	}
+	n := new(big.Int).SetUint64(w.Hi)
+	n.Lsh(n, 64).Or(n, new(big.Int).SetUint64(w.Lo))
+	return n.String()
+}
+
+// binaryString renders the low bits bits of w, zero padded.
+func binaryString(w keybits.Uint128, bits int) string {
+	if bits <= 64 {
+		return fmt.Sprintf("%0*b", bits, w.Lo)
+	}
+	return fmt.Sprintf("%0*b%064b", bits-64, w.Hi, w.Lo)
+}
+
+// hexString renders the low bits bits of w as zero-padded hex.
+func hexString(w keybits.Uint128, bits int) string {
+	if bits <= 64 {
+		return fmt.Sprintf("%0*x", bits/4, w.Lo)
+	}
+	return w.String()
+}
@@ -0,0 +1,207 @@
+// Command shardkey encodes, decodes and inspects sharded keys from the
+// command line, so on-call engineers can tell which shard a key lives on.
+//
+// Usage:
+//
+//	shardkey <command> [flags] [value ...]
+//
+// Commands:
+//
+//	encode   encode original values
+//	decode   decode encoded values
+//	prefix   print the shard prefix of encoded values
+//	inspect  print the bit-level breakdown of original values
+//	stats    report how original values, or a synthetic workload, spread
+//	         across shard prefixes
+//
+// Values are read from the arguments or, if there are none, one per line
+// from standard input.  Integers may be 0x-prefixed hex, or else decimal
+// or, when -format is given, that format's notation; 128-bit keys may be
+// UUIDs or ULIDs.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sean-/go-sharded-cluster-keys/keybits"
+	"github.com/sean-/go-sharded-cluster-keys/layout"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+const usage = `usage: shardkey <encode|decode|prefix|inspect|stats> [flags] [value ...]
+
+Run "shardkey <command> -h" for the flags of a command.
+`
+
+// presets are the layouts of keyuuid's preset encoders.
+var presets = map[string]struct{ width, total, offset, size int }{
+	"uuidv7": {128, 48, 11, 4},
+	"ulid":   {128, 48, 16, 16},
+}
+
+// command is one subcommand: it handles a single input value.
+type command func(w io.Writer, k shardKey, v keybits.Uint128) error
+
+var commands = map[string]command{
+	"encode":  func(w io.Writer, k shardKey, v keybits.Uint128) error { return writeLine(w, k.Format(k.Encode(v))) },
+	"decode":  func(w io.Writer, k shardKey, v keybits.Uint128) error { return writeLine(w, k.Format(k.Decode(v))) },
+	"prefix":  func(w io.Writer, k shardKey, v keybits.Uint128) error { return writeLine(w, k.Prefix(v)) },
+	"inspect": inspect,
+}
+
+func writeLine(w io.Writer, a any) error {
+	_, err := fmt.Fprintln(w, a)
+	return err
+}
+
+// run executes the command line and returns the process exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	name, cmd := args[0], commands[args[0]]
+	if cmd == nil && name != "stats" {
+		fmt.Fprintf(stderr, "shardkey: unknown command %q\n%s", name, usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("shardkey "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	width := fs.Int("width", 64, "key width in bits: 32, 64 or 128 (UUID/ULID)")
+	total := fs.Int("total", 48, "for 128-bit keys, the number of top bits holding the shuffled field")
+	offset := fs.Int("offset", 0, "bit offset (0 = LSB) of the shard segment")
+	size := fs.Int("size", 0, "size in bits of the shard segment")
+	preset := fs.String("preset", "", "use a preset layout: uuidv7 or ulid")
+	spec := fs.String("layout", "", "use a layout spec such as k64:o11:s13 or uuid:t48:o11:s4")
+	format := fs.String("format", "", "output format: decimal, hex or base32 for integers; uuid or ulid for 128-bit keys")
+	var stats statsFlags
+	if name == "stats" {
+		stats.register(fs)
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	explicit := set["width"] || set["total"] || set["offset"] || set["size"]
+	switch {
+	case *preset != "" && *spec != "":
+		fmt.Fprintln(stderr, "shardkey: -preset cannot be combined with -layout")
+		return 2
+	case *preset != "":
+		p, ok := presets[*preset]
+		if !ok {
+			fmt.Fprintf(stderr, "shardkey: unknown preset %q\n", *preset)
+			return 2
+		}
+		if explicit {
+			fmt.Fprintln(stderr, "shardkey: -preset cannot be combined with -width, -total, -offset or -size")
+			return 2
+		}
+		*width, *total, *offset, *size = p.width, p.total, p.offset, p.size
+	case *spec != "":
+		l, err := layout.ParseLayout(*spec)
+		if err != nil {
+			fmt.Fprintf(stderr, "shardkey: %v\n", err)
+			return 2
+		}
+		if explicit {
+			fmt.Fprintln(stderr, "shardkey: -layout cannot be combined with -width, -total, -offset or -size")
+			return 2
+		}
+		*width, *total, *offset, *size = l.Width, l.Total, l.Offset, l.Size
+	case !set["size"]:
+		fmt.Fprintln(stderr, "shardkey: a layout is required: pass -size (and -offset, -width), -preset or -layout")
+		return 2
+	}
+
+	k, err := newShardKey(*width, *total, *offset, *size, *format)
+	if err != nil {
+		fmt.Fprintf(stderr, "shardkey: %v\n", err)
+		return 2
+	}
+
+	if name == "stats" {
+		if err := runStats(stdout, k, stats, fs.Args(), stdin); err != nil {
+			fmt.Fprintf(stderr, "shardkey: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if err := forEachValue(fs.Args(), stdin, func(s string) error {
+		v, err := k.Parse(s)
+		if err != nil {
+			return err
+		}
+		return cmd(stdout, k, v)
+	}); err != nil {
+		fmt.Fprintf(stderr, "shardkey: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// forEachValue calls fn for every argument, or for every non-blank line of
+// stdin when there are no arguments.
+func forEachValue(args []string, stdin io.Reader, fn func(string) error) error {
+	if len(args) > 0 {
+		for _, a := range args {
+			if err := fn(a); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	sc := bufio.NewScanner(stdin)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// inspect prints the original, encoded and prefix forms of v in decimal,
+// hex and binary, like the examples/key_uint* programs.
+func inspect(out io.Writer, k shardKey, v keybits.Uint128) error {
+	bits := k.Bits()
+	encoded := k.Encode(v)
+	prefix := keybits.Uint128From(k.Prefix(encoded))
+	padded := prefix.Lsh(k.PrefixHexSize()*4 - k.PrefixSize())
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "layout:\t%s\n", k.Describe())
+	fmt.Fprintf(w, "hex nibbles:\t%d\n", k.PrefixHexSize())
+	fmt.Fprintln(w, "Input\tDecimal\tHex\tBinary\t")
+	for _, row := range []struct {
+		name string
+		v    keybits.Uint128
+		hex  string
+		bin  string
+	}{
+		{"orig", v, hexString(v, bits), binaryString(v, bits)},
+		{"encoded", encoded, hexString(encoded, bits), binaryString(encoded, bits)},
+		{"prefix", prefix, hexString(padded, k.PrefixHexSize()*4), binaryString(prefix, k.PrefixSize())},
+	} {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", row.name, decimal(row.v), row.hex, row.bin)
+	}
+	fmt.Fprintln(w)
+	return w.Flush()
+}
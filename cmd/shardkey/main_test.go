@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func runCmd(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestEncodeDecode(t *testing.T) {
+	tests := []struct {
+		name      string
+		layout    []string
+		orig, enc string
+		dec       string // decode output, in the -format notation
+	}{
+		{"key64", []string{"-offset", "8", "-size", "8"}, "0x0123456789ABCDEF", "12898629588762602479", "81985529216486895"},
+		{"key64-hex", []string{"-offset", "8", "-size", "8", "-format", "hex"}, "0x0123456789abcdef", "b3-0123456789abef", "01-23456789abcdef"},
+		{"key32", []string{"-width", "32", "-offset", "8", "-size", "8", "-format", "hex"}, "0x12345678", "6a-123478", "12-345678"},
+		{"key32-layout", []string{"-layout", "k32:o8:s8", "-format", "hex"}, "0x12345678", "6a-123478", "12-345678"},
+		{"uuid-layout", []string{"-layout", "uuid:t48:o11:s4"}, "018f14e0-8f0a-7def-91b4-f0ecb69f5f01", "8018f14e-0f0a-7def-91b4-f0ecb69f5f01", "018f14e0-8f0a-7def-91b4-f0ecb69f5f01"},
+		{"uuidv7", []string{"-preset", "uuidv7"}, "018f14e0-8f0a-7def-91b4-f0ecb69f5f01", "8018f14e-0f0a-7def-91b4-f0ecb69f5f01", "018f14e0-8f0a-7def-91b4-f0ecb69f5f01"},
+		{"ulid", []string{"-preset", "ulid", "-format", "ulid"}, "01ARYZ6S41TSV4RRFFQ69G5FAV", "", "01ARYZ6S41TSV4RRFFQ69G5FAV"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			code, out, errOut := runCmd(t, "", append(append([]string{"encode"}, tc.layout...), tc.orig)...)
+			require.Equal(t, 0, code, errOut)
+			enc := strings.TrimSpace(out)
+			if tc.enc != "" {
+				require.Equal(t, tc.enc, enc)
+			}
+
+			// feed the encoded value back through decode on stdin
+			code, out, errOut = runCmd(t, enc+"\n", append([]string{"decode"}, tc.layout...)...)
+			require.Equal(t, 0, code, errOut)
+			require.Equal(t, tc.dec, strings.TrimSpace(out))
+		})
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	for _, width := range []string{"32", "64"} {
+		for _, format := range []string{"decimal", "hex", "base32"} {
+			layout := []string{"-width", width, "-offset", "3", "-size", "5", "-format", format}
+			code, out, errOut := runCmd(t, "", append(append([]string{"encode"}, layout...), "0x01234567")...)
+			require.Equal(t, 0, code, errOut)
+			enc := strings.TrimSpace(out)
+
+			code, out, errOut = runCmd(t, "", append(append([]string{"decode"}, layout...), enc)...)
+			require.Equal(t, 0, code, errOut)
+			dec := strings.TrimSpace(out)
+
+			// The decoded text, read back in the same format, encodes to
+			// the same key.
+			code, out, errOut = runCmd(t, "", append(append([]string{"encode"}, layout...), dec)...)
+			require.Equalf(t, 0, code, "width=%s format=%s: %s", width, format, errOut)
+			require.Equalf(t, enc, strings.TrimSpace(out), "width=%s format=%s", width, format)
+		}
+	}
+
+	// All-digit base32 is base32, not decimal.
+	_, thirtyTwo, _ := runCmd(t, "", "decode", "-offset", "0", "-size", "1", "-format", "base32", "0000000000010")
+	_, ten, _ := runCmd(t, "", "decode", "-offset", "0", "-size", "1", "-format", "base32", "000000000000A")
+	require.NotEqual(t, ten, thirtyTwo)
+	require.Equal(t, "0000000000020\n", thirtyTwo) // 32 decodes to 64 with offset 0
+}
+
+func TestPrefixAndInspect(t *testing.T) {
+	code, out, errOut := runCmd(t, "", "prefix", "-offset", "11", "-size", "13", "11432397662079176175")
+	require.Equal(t, 0, code, errOut)
+	require.Equal(t, "5077\n", out)
+
+	code, out, errOut = runCmd(t, "", "inspect", "-offset", "11", "-size", "13", "0x0123456789ABCDEF")
+	require.Equal(t, 0, code, errOut)
+	require.Contains(t, out, "width=64 offset=11 size=13")
+	require.Regexp(t, `orig\s+81985529216486895\s+0123456789abcdef\s+0{7}1001`, out)
+	require.Regexp(t, `encoded\s+11432397662079176175\s+9ea8091a2b3c4def`, out)
+	require.Regexp(t, `prefix\s+5077\s+9ea8\s+1001111010101\s`, out)
+}
+
+func TestUsageErrors(t *testing.T) {
+	for name, args := range map[string][]string{
+		"no-command":      nil,
+		"unknown-command": {"frobnicate"},
+		"no-layout":       {"encode", "1"},
+		"bad-width":       {"encode", "-width", "16", "-size", "4", "1"},
+		"overflow":        {"encode", "-offset", "60", "-size", "8", "1"},
+		"preset-and-size": {"encode", "-preset", "uuidv7", "-size", "4"},
+		"unknown-preset":  {"encode", "-preset", "uuidv9"},
+		"bad-format":      {"encode", "-preset", "uuidv7", "-format", "hex"},
+		"bad-layout":      {"encode", "-layout", "k64:o11"},
+		"layout-overflow": {"encode", "-layout", "k32:o30:s4"},
+		"layout-and-size": {"encode", "-layout", "k64:o1:s1", "-size", "4"},
+		"layout-preset":   {"encode", "-layout", "k64:o1:s1", "-preset", "ulid"},
+	} {
+		code, _, errOut := runCmd(t, "", args...)
+		require.Equalf(t, 2, code, "%s: %s", name, errOut)
+	}
+
+	code, _, errOut := runCmd(t, "", "encode", "-size", "4", "not-a-number")
+	require.Equal(t, 1, code)
+	require.Contains(t, errOut, "unrecognized key")
+}
+
+func TestStats(t *testing.T) {
+	code, out, errOut := runCmd(t, "", "stats", "-offset", "8", "-size", "4", "-workload", "sequential", "-n", "4096", "-window", "1s")
+	require.Equal(t, 0, code, errOut)
+	require.Contains(t, out, "prefixes:      16 (min 256, max 256, skew 1.00)")
+	require.Contains(t, out, "rotations:     15 (mean dwell 256ms)")
+	require.Regexp(t, `(?m)^3s\s+1000\s+5\s`, out)
+
+	code, out, errOut = runCmd(t, "1\n2\n3\n4\n", "stats", "-size", "2", "-counts", "-window", "0")
+	require.Equal(t, 0, code, errOut)
+	require.Contains(t, out, "chi-squared:   0.00 (3 dof, p=1)")
+	require.Regexp(t, `(?m)^3\s+1\s`, out)
+
+	code, out, errOut = runCmd(t, "", "stats", "-preset", "uuidv7", "-workload", "uuidv7", "-arrivals", "poisson", "-n", "1000")
+	require.Equal(t, 0, code, errOut)
+	require.Contains(t, out, "writes:        1000")
+
+	code, _, errOut = runCmd(t, "", "stats", "-preset", "uuidv7", "-workload", "sequential")
+	require.Equal(t, 1, code)
+	require.Contains(t, errOut, "needs a 32- or 64-bit key")
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"iter"
+	"math/rand/v2"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sean-/go-sharded-cluster-keys/key64/gen"
+	"github.com/sean-/go-sharded-cluster-keys/keybits"
+	"github.com/sean-/go-sharded-cluster-keys/keystats"
+)
+
+// statsFlags are the flags only the stats command takes.
+type statsFlags struct {
+	workload string
+	arrivals string
+	rate     float64
+	n        int
+	start    uint64
+	window   time.Duration
+	seed     uint64
+	counts   bool
+}
+
+func (f *statsFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.workload, "workload", "", "synthesise IDs instead of reading them: sequential, snowflake (64-bit) or uuidv7 (128-bit)")
+	fs.StringVar(&f.arrivals, "arrivals", "steady", "arrival process: steady or poisson")
+	fs.Float64Var(&f.rate, "rate", 1000, "writes per second")
+	fs.IntVar(&f.n, "n", 100_000, "number of synthetic writes")
+	fs.Uint64Var(&f.start, "start", 0, "first ID of the sequential workload")
+	fs.DurationVar(&f.window, "window", time.Second, "rotation window length")
+	fs.Uint64Var(&f.seed, "seed", 1, "random seed for poisson arrivals and uuidv7 entropy")
+	fs.BoolVar(&f.counts, "counts", false, "also print the write count of every prefix")
+}
+
+// begin is the arbitrary instant synthetic workloads start at.
+var begin = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// runStats simulates a workload, or replays the input values at -rate,
+// and prints how it spreads across shard prefixes.
+func runStats(out io.Writer, k shardKey, f statsFlags, args []string, stdin io.Reader) error {
+	if f.rate <= 0 {
+		return errors.New("-rate must be positive")
+	}
+	var src iter.Seq2[keystats.Sample, error]
+	if f.workload == "" {
+		src = inputSamples(k, f.rate, args, stdin)
+	} else {
+		var arrivals iter.Seq[time.Time]
+		switch f.arrivals {
+		case "steady":
+			arrivals = keystats.Steady(begin, f.rate, f.n)
+		case "poisson":
+			arrivals = keystats.Poisson(begin, f.rate, f.n, rand.New(rand.NewPCG(f.seed, 0)))
+		default:
+			return fmt.Errorf("unknown arrival process %q (want steady or poisson)", f.arrivals)
+		}
+		keyer, err := workloadKeyer(k, f)
+		if err != nil {
+			return err
+		}
+		src = keystats.Workload(arrivals, keyer)
+	}
+
+	r, err := keystats.Analyze(k.PrefixSize(), f.window, src)
+	if err != nil {
+		return err
+	}
+	printReport(out, k, r, f.counts)
+	return nil
+}
+
+// workloadKeyer returns the keystats.Keyer for -workload.
+func workloadKeyer(k shardKey, f statsFlags) (keystats.Keyer, error) {
+	switch f.workload {
+	case "sequential":
+		if k.Bits() == 128 {
+			return nil, fmt.Errorf("the sequential workload needs a 32- or 64-bit key")
+		}
+		return keystats.Sequential(func(v uint64) uint64 {
+			return k.Prefix(k.Encode(keybits.Uint128From(v)))
+		}, f.start), nil
+	case "snowflake":
+		k64, ok := k.(int64Key)
+		if !ok {
+			return nil, fmt.Errorf("the snowflake workload needs a 64-bit key")
+		}
+		return keystats.Snowflake(gen.Config{
+			Encoder:      k64.enc,
+			Epoch:        begin,
+			WorkerBits:   10,
+			SequenceBits: 12,
+		})
+	case "uuidv7":
+		ku, ok := k.(uuidKey)
+		if !ok {
+			return nil, fmt.Errorf("the uuidv7 workload needs a 128-bit key")
+		}
+		var seed [32]byte
+		for i := range 8 {
+			seed[i] = byte(f.seed >> (8 * i))
+		}
+		return keystats.UUIDv7(ku.enc, rand.NewChaCha8(seed)), nil
+	}
+	return nil, fmt.Errorf("unknown workload %q (want sequential, snowflake or uuidv7)", f.workload)
+}
+
+// inputSamples turns the input values into samples arriving steadily at
+// rate writes per second.
+func inputSamples(k shardKey, rate float64, args []string, stdin io.Reader) iter.Seq2[keystats.Sample, error] {
+	step := time.Duration(float64(time.Second) / rate)
+	return func(yield func(keystats.Sample, error) bool) {
+		at := begin
+		stopped := false
+		err := forEachValue(args, stdin, func(s string) error {
+			v, err := k.Parse(s)
+			if err != nil {
+				return err
+			}
+			if !yield(keystats.Sample{At: at, Prefix: k.Prefix(k.Encode(v))}, nil) {
+				stopped = true
+				return errStop
+			}
+			at = at.Add(step)
+			return nil
+		})
+		if err != nil && !stopped {
+			yield(keystats.Sample{}, err)
+		}
+	}
+}
+
+// errStop ends forEachValue early when the consumer stops iterating.
+var errStop = errors.New("stop")
+
+func printReport(out io.Writer, k shardKey, r keystats.Report, counts bool) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "layout:\t%s\n", k.Describe())
+	fmt.Fprintf(w, "writes:\t%d\n", r.Total)
+	fmt.Fprintf(w, "prefixes:\t%d (min %d, max %d, skew %.2f)\n", len(r.Counts), r.Min, r.Max, r.Skew)
+	fmt.Fprintf(w, "chi-squared:\t%.2f (%d dof, p=%.3g)\n", r.ChiSquared, r.DegreesOfFreedom, r.PValue)
+	fmt.Fprintf(w, "rotations:\t%d (mean dwell %s)\n", r.Rotations, r.MeanDwell)
+	fmt.Fprintln(w)
+
+	if len(r.Windows) > 0 {
+		fmt.Fprintln(w, "Window\tWrites\tPrefixes\tTop share\t")
+		for _, win := range r.Windows {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t\n", win.Start.Sub(r.Windows[0].Start), win.Count, win.Prefixes, 100*win.TopShare)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if counts {
+		fmt.Fprintln(w, "Prefix\tWrites\t")
+		for p, n := range r.Counts {
+			fmt.Fprintf(w, "%d\t%d\t\n", p, n)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
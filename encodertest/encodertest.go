@@ -0,0 +1,235 @@
+// Package encodertest is a conformance suite for shard-key encoders.  It
+// checks the contract every key32, key64 and keyuuid Encoder honours so
+// custom implementations can be held to the same rules:
+//
+//   - Decode(Encode(v)) == v for every v, and Encode(Decode(x)) == x for
+//     every encoded x, so Encode is a bijection;
+//   - the prefix of Encode(v) is the size bits of v starting at offset,
+//     in reverse order, and occupies the top size bits of the encoded
+//     word;
+//   - the layout accessors report the offset and size the encoder was
+//     built with, and invalid layouts are rejected.
+//
+// Run and RunUUID sweep every layout of a word; CheckValue and
+// CheckUUIDValue check one value and are meant for fuzz targets.
+package encodertest
+
+import (
+	"math/bits"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// Unsigned is the set of word types an integer Encoder may operate on.
+type Unsigned interface {
+	~uint16 | ~uint32 | ~uint64
+}
+
+// Encoder is the contract of key32.Encoder and key64.Encoder over original
+// values of type T and encoded values of type V.
+type Encoder[T, V Unsigned] interface {
+	Encode(v T) V
+	Decode(v V) T
+	Prefix(v V) T
+	LeftSize() int
+	PrefixSize() int
+	RightSize() int
+	EncodedBits() int
+}
+
+// sliceEncoder is the optional batch API; Run checks it when present.
+type sliceEncoder[T, V Unsigned] interface {
+	EncodeSlice(dst []V, src []T)
+	DecodeSlice(dst []T, src []V)
+}
+
+// samples is the number of random values checked per layout.
+const samples = 32
+
+// Run checks every (offset, size) layout of T's width.  factory must build
+// an encoder for a valid layout and return an error for an invalid one,
+// like key64.NewEncoderE:
+//
+//	encodertest.Run[uint64, key64.Value](t, key64.NewEncoderE)
+func Run[T, V Unsigned, E Encoder[T, V]](t *testing.T, factory func(offset, size int) (E, error)) {
+	t.Helper()
+	width := wordBits[T]()
+	rng := rand.New(rand.NewPCG(uint64(width), 0))
+
+	for _, l := range [][2]int{{-1, 1}, {1, -1}, {width, 1}, {0, width + 1}, {width/2 + 1, width / 2}} {
+		if _, err := factory(l[0], l[1]); err == nil {
+			t.Fatalf("factory(%d, %d) accepted an invalid %d-bit layout", l[0], l[1], width)
+		}
+	}
+
+	for offset := 0; offset <= width; offset++ {
+		for size := 0; offset+size <= width; size++ {
+			enc, err := factory(offset, size)
+			if err != nil {
+				t.Fatalf("factory(%d, %d): %v", offset, size, err)
+			}
+			if got := [4]int{enc.LeftSize(), enc.PrefixSize(), enc.RightSize(), enc.EncodedBits()}; got != [4]int{offset, size, width - offset - size, width} {
+				t.Fatalf("offset=%d size=%d: Left/Prefix/Right/EncodedBits = %v", offset, size, got)
+			}
+
+			values := []T{0, ^T(0), T(1) << offset, ^T(0) >> (width - offset - size)}
+			for range samples {
+				values = append(values, T(rng.Uint64()))
+			}
+			for _, v := range values {
+				CheckValue[T, V](t, enc, offset, size, v)
+			}
+			checkSlices[T, V](t, enc, offset, size, values)
+		}
+	}
+}
+
+// CheckValue checks the Encoder contract for one value v, and for v read
+// as an encoded value, under the layout (offset, size).
+func CheckValue[T, V Unsigned, E Encoder[T, V]](t testing.TB, enc E, offset, size int, v T) {
+	t.Helper()
+	width := wordBits[T]()
+
+	e := enc.Encode(v)
+	if got := enc.Decode(e); got != v {
+		t.Fatalf("offset=%d size=%d: Decode(Encode(%#x)) = %#x", offset, size, v, got)
+	}
+	if x := V(v); enc.Encode(enc.Decode(x)) != x {
+		t.Fatalf("offset=%d size=%d: Encode(Decode(%#x)) = %#x", offset, size, x, enc.Encode(enc.Decode(x)))
+	}
+
+	want := reverse(uint64(v)>>offset&mask(size), size)
+	if got := uint64(enc.Prefix(e)); got != want {
+		t.Fatalf("offset=%d size=%d: Prefix(Encode(%#x)) = %#x, want %#x", offset, size, v, got, want)
+	}
+	if top := uint64(e) >> (width - size); size > 0 && top != want {
+		t.Fatalf("offset=%d size=%d: top bits of Encode(%#x) = %#x, want prefix %#x", offset, size, v, top, want)
+	}
+}
+
+// checkSlices checks that the batch API, if enc has one, agrees with
+// Encode and Decode.
+func checkSlices[T, V Unsigned, E Encoder[T, V]](t testing.TB, enc E, offset, size int, values []T) {
+	t.Helper()
+	s, ok := any(enc).(sliceEncoder[T, V])
+	if !ok {
+		return
+	}
+	encoded := make([]V, len(values))
+	s.EncodeSlice(encoded, values)
+	decoded := make([]T, len(values))
+	s.DecodeSlice(decoded, encoded)
+	for i, v := range values {
+		if encoded[i] != enc.Encode(v) || decoded[i] != v {
+			t.Fatalf("offset=%d size=%d: EncodeSlice/DecodeSlice disagree with Encode/Decode at %#x", offset, size, v)
+		}
+	}
+}
+
+// UUIDEncoder is the contract of keyuuid.Encoder.
+type UUIDEncoder interface {
+	Encode(u uuid.UUID) uuid.UUID
+	Decode(u uuid.UUID) uuid.UUID
+	PrefixBits(u uuid.UUID) uint64
+	PrefixSize() int
+}
+
+// RunUUID checks every (offset, size) layout of a selection of field
+// widths, with factory(totalBits, offset, size) built like
+// keyuuid.NewEncoderE.  Beyond the integer contract it checks that bits
+// outside the top totalBits are left untouched.
+func RunUUID[E UUIDEncoder](t *testing.T, factory func(totalBits, offset, size int) (E, error)) {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(128, 0))
+
+	for _, l := range [][3]int{{-1, 0, 1}, {65, 0, 1}, {48, 40, 9}, {48, -1, 4}} {
+		if _, err := factory(l[0], l[1], l[2]); err == nil {
+			t.Fatalf("factory(%d, %d, %d) accepted an invalid layout", l[0], l[1], l[2])
+		}
+	}
+
+	for _, total := range []int{1, 16, 48, 64} {
+		for offset := 0; offset <= total; offset++ {
+			for size := 0; offset+size <= total; size++ {
+				enc, err := factory(total, offset, size)
+				if err != nil {
+					t.Fatalf("factory(%d, %d, %d): %v", total, offset, size, err)
+				}
+				if enc.PrefixSize() != size {
+					t.Fatalf("total=%d offset=%d size=%d: PrefixSize() = %d", total, offset, size, enc.PrefixSize())
+				}
+				for range samples / 4 {
+					var u uuid.UUID
+					for i := range u {
+						u[i] = byte(rng.Uint32())
+					}
+					CheckUUIDValue(t, enc, total, offset, size, u)
+				}
+			}
+		}
+	}
+}
+
+// CheckUUIDValue checks the UUIDEncoder contract for one UUID under the
+// layout (totalBits, offset, size).
+func CheckUUIDValue[E UUIDEncoder](t testing.TB, enc E, totalBits, offset, size int, u uuid.UUID) {
+	t.Helper()
+
+	e := enc.Encode(u)
+	if got := enc.Decode(e); got != u {
+		t.Fatalf("total=%d offset=%d size=%d: Decode(Encode(%s)) = %s", totalBits, offset, size, u, got)
+	}
+	if got := enc.Encode(enc.Decode(u)); got != u {
+		t.Fatalf("total=%d offset=%d size=%d: Encode(Decode(%s)) = %s", totalBits, offset, size, u, got)
+	}
+
+	keep := ^uint64(0) >> totalBits // bits below the field
+	if totalBits == 0 {
+		keep = ^uint64(0)
+	}
+	msb, emsb := be64(u[0:8]), be64(e[0:8])
+	if msb&keep != emsb&keep || [8]byte(u[8:16]) != [8]byte(e[8:16]) {
+		t.Fatalf("total=%d offset=%d size=%d: Encode(%s) = %s changed bits outside the field", totalBits, offset, size, u, e)
+	}
+
+	var want uint64
+	if totalBits > 0 {
+		want = reverse(msb>>(64-totalBits)>>offset&mask(size), size)
+	}
+	if got := enc.PrefixBits(e); got != want {
+		t.Fatalf("total=%d offset=%d size=%d: PrefixBits(Encode(%s)) = %#x, want %#x", totalBits, offset, size, u, got, want)
+	}
+	if top := emsb >> (64 - size); size > 0 && top != want {
+		t.Fatalf("total=%d offset=%d size=%d: top bits of Encode(%s) = %#x, want prefix %#x", totalBits, offset, size, u, top, want)
+	}
+}
+
+// wordBits returns the width in bits of T.
+func wordBits[T Unsigned]() int {
+	return bits.Len64(uint64(^T(0)))
+}
+
+// mask returns the low n bits set.  1<<64 is zero, so n may be 64.
+func mask(n int) uint64 {
+	return 1<<n - 1
+}
+
+// reverse reverses the low n bits of x one bit at a time, independently of
+// the bits.Reverse64 shortcut the encoders use.
+func reverse(x uint64, n int) uint64 {
+	var out uint64
+	for i := 0; i < n; i++ {
+		out = out<<1 | x>>i&1
+	}
+	return out
+}
+
+func be64(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
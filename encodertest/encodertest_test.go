@@ -0,0 +1,93 @@
+package encodertest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sean-/go-sharded-cluster-keys/keybits"
+)
+
+func newKeybits16(offset, size int) (keybits.Encoder[uint16], error) {
+	e := keybits.NewEncoder[uint16](offset, size)
+	return e, e.Validate()
+}
+
+func TestRunKeybits(t *testing.T) {
+	Run[uint16, uint16](t, newKeybits16)
+}
+
+// unreversed moves the segment to the top without reversing it, which
+// round-trips but breaks the prefix contract.
+type unreversed struct{ keybits.Encoder[uint16] }
+
+func (u unreversed) Encode(v uint16) uint16 {
+	o, s := u.LeftSize(), u.PrefixSize()
+	field := v >> o & (1<<s - 1)
+	rest := v>>(o+s)<<o | v&(1<<o-1)
+	return field<<(16-s) | rest
+}
+
+func (u unreversed) Decode(e uint16) uint16 {
+	o, s := u.LeftSize(), u.PrefixSize()
+	field := e >> (16 - s) & (1<<s - 1)
+	rest := e & (1<<(16-s) - 1)
+	return rest>>o<<(o+s) | field<<o | rest&(1<<o-1)
+}
+
+func (u unreversed) Prefix(e uint16) uint16 { return e >> (16 - u.PrefixSize()) }
+
+// recorder is a testing.TB that records the first fatal failure.
+type recorder struct {
+	testing.TB
+	failed string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Fatalf(format string, args ...any) {
+	r.failed = fmt.Sprintf(format, args...)
+	panic(r)
+}
+
+func check(tb testing.TB, fn func(tb testing.TB)) (failure string) {
+	r := &recorder{TB: tb}
+	defer func() {
+		if p := recover(); p != nil && p != r {
+			panic(p)
+		}
+		failure = r.failed
+	}()
+	fn(r)
+	return ""
+}
+
+func TestCheckValueCatchesBrokenPrefix(t *testing.T) {
+	good, err := newKeybits16(4, 4)
+	require.NoError(t, err)
+	bad := unreversed{good}
+
+	require.Empty(t, check(t, func(tb testing.TB) { CheckValue[uint16, uint16](tb, good, 4, 4, 0x1234) }))
+	require.Equal(t, uint16(0x1234), bad.Decode(bad.Encode(0x1234)), "the broken encoder still round-trips")
+	require.Contains(t, check(t, func(tb testing.TB) { CheckValue[uint16, uint16](tb, bad, 4, 4, 0x1234) }), "Prefix(Encode(0x1234))")
+}
+
+// identity never moves any bits: valid only for the identity layout.
+type identity struct{}
+
+func (identity) Encode(u uuid.UUID) uuid.UUID { return u }
+func (identity) Decode(u uuid.UUID) uuid.UUID { return u }
+func (identity) PrefixBits(uuid.UUID) uint64  { return 0 }
+func (identity) PrefixSize() int              { return 0 }
+
+func TestCheckUUIDValue(t *testing.T) {
+	var u [16]byte
+	for i := range u {
+		u[i] = byte(i * 37)
+	}
+	id := identity{}
+	require.Empty(t, check(t, func(tb testing.TB) { CheckUUIDValue(tb, id, 0, 0, 0, u) }))
+	require.Contains(t, check(t, func(tb testing.TB) { CheckUUIDValue(tb, id, 48, 0, 4, u) }), "PrefixBits")
+}
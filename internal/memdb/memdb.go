@@ -0,0 +1,145 @@
+// Package memdb is a tiny in-memory database/sql driver that stands in for
+// SQLite in tests.  Like SQLite it hands values back with the same driver
+// type they were stored with (INTEGER as int64, BLOB as []byte, TEXT as
+// string).  It understands exactly three statements:
+//
+//	CREATE TABLE <name> (<columns>)
+//	INSERT INTO <name> VALUES (?, ...)
+//	SELECT * FROM <name>
+//
+// Each DSN names an independent database.
+package memdb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// DriverName is the name memdb registers with database/sql.
+const DriverName = "memdb"
+
+func init() {
+	sql.Register(DriverName, &memDriver{dbs: make(map[string]*database)})
+}
+
+type memDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*database
+}
+
+func (d *memDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	db, ok := d.dbs[name]
+	if !ok {
+		db = &database{tables: make(map[string]*table)}
+		d.dbs[name] = db
+	}
+	return &conn{db: db}, nil
+}
+
+type database struct {
+	mu     sync.Mutex
+	tables map[string]*table
+}
+
+type table struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+type conn struct {
+	db *database
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{db: c.db, query: query}, nil
+}
+
+func (c *conn) Close() error { return nil }
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("memdb: transactions are not supported")
+}
+
+type stmt struct {
+	db    *database
+	query string
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return -1 }
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	f := strings.Fields(s.query)
+	switch {
+	case len(f) >= 3 && strings.EqualFold(f[0], "CREATE") && strings.EqualFold(f[1], "TABLE"):
+		open, end := strings.Index(s.query, "("), strings.LastIndex(s.query, ")")
+		if open < 0 || end < open {
+			return nil, fmt.Errorf("memdb: malformed CREATE TABLE: %q", s.query)
+		}
+		var cols []string
+		for _, c := range strings.Split(s.query[open+1:end], ",") {
+			cols = append(cols, strings.Fields(c)[0])
+		}
+		s.db.tables[strings.TrimSuffix(f[2], "(")] = &table{columns: cols}
+		return driver.RowsAffected(0), nil
+
+	case len(f) >= 4 && strings.EqualFold(f[0], "INSERT") && strings.EqualFold(f[1], "INTO"):
+		t, ok := s.db.tables[f[2]]
+		if !ok {
+			return nil, fmt.Errorf("memdb: no such table: %s", f[2])
+		}
+		if len(args) != len(t.columns) {
+			return nil, fmt.Errorf("memdb: %d values for %d columns", len(args), len(t.columns))
+		}
+		row := make([]driver.Value, len(args))
+		for i, a := range args {
+			if b, ok := a.([]byte); ok {
+				a = append([]byte(nil), b...)
+			}
+			row[i] = a
+		}
+		t.rows = append(t.rows, row)
+		return driver.RowsAffected(1), nil
+	}
+	return nil, fmt.Errorf("memdb: unsupported statement: %q", s.query)
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	f := strings.Fields(s.query)
+	if len(f) != 4 || !strings.EqualFold(f[0], "SELECT") || f[1] != "*" || !strings.EqualFold(f[2], "FROM") {
+		return nil, fmt.Errorf("memdb: unsupported query: %q", s.query)
+	}
+	t, ok := s.db.tables[f[3]]
+	if !ok {
+		return nil, fmt.Errorf("memdb: no such table: %s", f[3])
+	}
+	return &rows{columns: t.columns, rows: append([][]driver.Value(nil), t.rows...)}, nil
+}
+
+type rows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,151 @@
+// Package textfmt implements the strict decimal, hex and Crockford base32
+// encodings shared by the key32 and key64 text formats.
+package textfmt
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrSyntax is wrapped by every parse error.
+var ErrSyntax = errors.New("malformed key")
+
+const (
+	hexDigits     = "0123456789abcdef"
+	crockford     = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	hexSeparator  = '-'
+	invalidSymbol = 0xff
+)
+
+// crockfordDec maps an ASCII byte to its base32 value, or invalidSymbol.
+// Lowercase is accepted; the ambiguous I, L, O and U are not.
+var crockfordDec = func() (t [256]byte) {
+	for i := range t {
+		t[i] = invalidSymbol
+	}
+	for i := 0; i < len(crockford); i++ {
+		t[crockford[i]] = byte(i)
+		t[crockford[i]|0x20] = byte(i)
+	}
+	return t
+}()
+
+// AppendDecimal appends v in unsigned decimal.
+func AppendDecimal(dst []byte, v uint64) []byte {
+	return strconv.AppendUint(dst, v, 10)
+}
+
+// ParseDecimal parses an unsigned decimal of at most bits bits.  Signs,
+// leading zeros and digit separators are rejected.
+func ParseDecimal(s string, bits int) (uint64, error) {
+	if len(s) == 0 || (len(s) > 1 && s[0] == '0') {
+		return 0, fmt.Errorf("%w: decimal %q", ErrSyntax, s)
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, fmt.Errorf("%w: decimal %q", ErrSyntax, s)
+		}
+	}
+	v, err := strconv.ParseUint(s, 10, bits)
+	if err != nil {
+		return 0, fmt.Errorf("%w: decimal %q out of range", ErrSyntax, s)
+	}
+	return v, nil
+}
+
+// AppendHex appends v as bits/4 lowercase hex digits, with a '-' after
+// the first prefixNibbles digits when prefixNibbles is positive.
+func AppendHex(dst []byte, v uint64, bits, prefixNibbles int) []byte {
+	n := bits / 4
+	for i := n - 1; i >= 0; i-- {
+		dst = append(dst, hexDigits[(v>>(4*i))&0xf])
+		if i == n-prefixNibbles && i > 0 {
+			dst = append(dst, hexSeparator)
+		}
+	}
+	return dst
+}
+
+// ParseHex parses the output of AppendHex.  Upper- and lowercase digits are
+// accepted; the width and separator position must match exactly.
+func ParseHex(s string, bits, prefixNibbles int) (uint64, error) {
+	n := bits / 4
+	sep := prefixNibbles > 0 && prefixNibbles < n
+	want := n
+	if sep {
+		want++
+	}
+	if len(s) != want {
+		return 0, fmt.Errorf("%w: hex %q must be %d characters", ErrSyntax, s, want)
+	}
+
+	var v uint64
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if sep && i == prefixNibbles {
+			if c != hexSeparator {
+				return 0, fmt.Errorf("%w: hex %q missing separator after %d digits", ErrSyntax, s, prefixNibbles)
+			}
+			continue
+		}
+		var d byte
+		switch {
+		case '0' <= c && c <= '9':
+			d = c - '0'
+		case 'a' <= c && c <= 'f':
+			d = c - 'a' + 10
+		case 'A' <= c && c <= 'F':
+			d = c - 'A' + 10
+		default:
+			return 0, fmt.Errorf("%w: hex %q", ErrSyntax, s)
+		}
+		v = v<<4 | uint64(d)
+	}
+	return v, nil
+}
+
+// base32Len returns the number of base32 symbols needed for bits bits.
+func base32Len(bits int) int {
+	return (bits + 4) / 5
+}
+
+// AppendBase32 appends v as fixed-width uppercase Crockford base32.
+func AppendBase32(dst []byte, v uint64, bits int) []byte {
+	for i := base32Len(bits) - 1; i >= 0; i-- {
+		dst = append(dst, crockford[(v>>(5*i))&0x1f])
+	}
+	return dst
+}
+
+// ParseBase32 parses fixed-width Crockford base32 of at most bits bits.
+func ParseBase32(s string, bits int) (uint64, error) {
+	n := base32Len(bits)
+	if len(s) != n {
+		return 0, fmt.Errorf("%w: base32 %q must be %d characters", ErrSyntax, s, n)
+	}
+
+	var v uint64
+	for i := 0; i < len(s); i++ {
+		d := crockfordDec[s[i]]
+		if d == invalidSymbol {
+			return 0, fmt.Errorf("%w: base32 %q", ErrSyntax, s)
+		}
+		if i == 0 && int(d)>>(bits-5*(n-1)) != 0 {
+			return 0, fmt.Errorf("%w: base32 %q out of range", ErrSyntax, s)
+		}
+		v = v<<5 | uint64(d)
+	}
+	return v, nil
+}
+
+// ParseJSON parses a JSON unsigned integer of at most bits bits, given
+// either as a bare number or as a quoted decimal string.  Both use the
+// strict ParseDecimal rules, so exponents and fractions are rejected.
+func ParseJSON(data []byte, bits int) (uint64, error) {
+	s := string(data)
+	if n := len(s); n >= 2 && s[0] == '"' && s[n-1] == '"' {
+		s = s[1 : n-1]
+	}
+	return ParseDecimal(s, bits)
+}
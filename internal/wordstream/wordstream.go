@@ -0,0 +1,47 @@
+// Package wordstream copies fixed-size binary words from a reader to a
+// writer in batches, converting each batch in place.  It backs the
+// EncodeStream and DecodeStream functions of key32, key64 and keyuuid.
+package wordstream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Batch is the number of words converted per read.
+const Batch = 512
+
+// ErrPartialWord is returned when the input ends part way through a word.
+// It wraps io.ErrUnexpectedEOF.
+var ErrPartialWord = fmt.Errorf("partial word at end of input: %w", io.ErrUnexpectedEOF)
+
+// Copy reads size-byte words from r until EOF, passes each batch of whole
+// words to convert, which rewrites them in place, and writes the result to
+// w.  It returns the number of words written.  Words before a trailing
+// partial word are still converted and written.
+func Copy(w io.Writer, r io.Reader, size int, convert func(words []byte)) (int64, error) {
+	buf := make([]byte, Batch*size)
+	var total int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if whole := n - n%size; whole > 0 {
+			convert(buf[:whole])
+			if _, err := w.Write(buf[:whole]); err != nil {
+				return total, err
+			}
+			total += int64(whole / size)
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, io.EOF):
+			return total, nil
+		case errors.Is(err, io.ErrUnexpectedEOF) && n%size == 0:
+			return total, nil
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return total, fmt.Errorf("%w: %d trailing bytes", ErrPartialWord, n%size)
+		default:
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package key32
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the binary encoding and the shard byte-range helpers.
+var (
+	ErrBinaryLength = errors.New("key32: binary Value must be 4 bytes")
+	ErrUnaligned    = errors.New("key32: prefix size is not a whole number of bytes")
+	ErrPrefixRange  = errors.New("key32: prefix out of range")
+)
+
+// AppendBinary implements encoding.BinaryAppender.  The form is 4 bytes,
+// big-endian, so byte-wise order equals numeric order of encoded Values
+// and an ordered key-value store keeps every shard contiguous.
+func (v Value) AppendBinary(b []byte) ([]byte, error) {
+	return binary.BigEndian.AppendUint32(b, uint32(v)), nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler; see AppendBinary.
+func (v Value) MarshalBinary() ([]byte, error) {
+	return v.AppendBinary(make([]byte, 0, 4))
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.  data must be
+// exactly 4 bytes.
+func (v *Value) UnmarshalBinary(data []byte) error {
+	if len(data) != 4 {
+		return fmt.Errorf("%w: got %d", ErrBinaryLength, len(data))
+	}
+	*v = Value(binary.BigEndian.Uint32(data))
+	return nil
+}
+
+// ShardBounds returns the binary key range [start, end) holding every
+// Value whose prefix under e is prefix, for range scans of an ordered
+// store.  end is nil for the last shard, meaning "to the end".
+func ShardBounds(e Encoder, prefix uint32) (start, end []byte, err error) {
+	size := e.PrefixSize()
+	shift := 32 - size
+	last := ^uint32(0) >> shift // a shift of 32 leaves zero
+	if prefix > last {
+		return nil, nil, fmt.Errorf("%w: %d needs more than %d bits", ErrPrefixRange, prefix, size)
+	}
+	start = binary.BigEndian.AppendUint32(nil, prefix<<shift)
+	if prefix != last {
+		end = binary.BigEndian.AppendUint32(nil, (prefix+1)<<shift)
+	}
+	return start, end, nil
+}
+
+// ShardPrefix returns the leading bytes shared by every binary Value in
+// shard prefix, for stores with prefix iteration.  It returns ErrUnaligned
+// unless e's prefix size is a multiple of 8; use ShardBounds otherwise.
+func ShardPrefix(e Encoder, prefix uint32) ([]byte, error) {
+	size := e.PrefixSize()
+	if size%8 != 0 {
+		return nil, fmt.Errorf("%w: %d bits", ErrUnaligned, size)
+	}
+	shift := 32 - size
+	if prefix > ^uint32(0)>>shift {
+		return nil, fmt.Errorf("%w: %d needs more than %d bits", ErrPrefixRange, prefix, size)
+	}
+	full := binary.BigEndian.AppendUint32(nil, prefix<<shift)
+	return full[:size/8], nil
+}
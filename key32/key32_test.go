@@ -1,9 +1,21 @@
 package key32
 
 import (
+	"bytes"
+	"cmp"
+	"database/sql"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/sean-/go-sharded-cluster-keys/encodertest"
+	"github.com/sean-/go-sharded-cluster-keys/internal/memdb"
+	"github.com/sean-/go-sharded-cluster-keys/keysql"
 )
 
 func TestEncoderInterface_TableDriven(t *testing.T) {
@@ -98,3 +110,344 @@ func TestEncoderInterface_TableDriven(t *testing.T) {
 		})
 	}
 }
+
+func TestNewEncoderE(t *testing.T) {
+	tests := []struct {
+		name         string
+		offset, size int
+		wantErr      error
+	}{
+		{name: "valid", offset: 11, size: 13},
+		{name: "empty-prefix", offset: 32, size: 0},
+		{name: "full-width", offset: 0, size: 32},
+		{name: "negative-offset", offset: -1, size: 4, wantErr: ErrNegativeOffset},
+		{name: "negative-size", offset: 4, size: -1, wantErr: ErrNegativeSize},
+		{name: "overflow", offset: 28, size: 5, wantErr: ErrLayoutOverflow},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			enc, err := NewEncoderE(tc.offset, tc.size)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				require.True(t, strings.HasPrefix(err.Error(), "key32: "), err.Error())
+				require.Nil(t, enc)
+				require.Panics(t, func() { MustNewEncoder(tc.offset, tc.size) })
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.offset, enc.LeftSize(), "LeftSize")
+			require.Equal(t, tc.size, enc.PrefixSize(), "PrefixSize")
+			require.NotPanics(t, func() { MustNewEncoder(tc.offset, tc.size) })
+		})
+	}
+}
+
+func TestEncodedRanges(t *testing.T) {
+	enc := NewEncoder(4, 3)
+
+	lo, hi := uint32(100), uint32(300)
+	ranges := enc.EncodedRanges(lo, hi)
+	require.NotEmpty(t, ranges)
+
+	covered := map[Value]bool{}
+	for _, r := range ranges {
+		for v := r.Lo; v <= r.Hi; v++ {
+			covered[v] = true
+		}
+	}
+	require.Len(t, covered, int(hi-lo+1))
+	for v := lo; v <= hi; v++ {
+		require.Truef(t, covered[enc.Encode(v)], "Encode(%d) not covered", v)
+	}
+}
+
+func TestSQLRoundTrip(t *testing.T) {
+	db, err := sql.Open(memdb.DriverName, t.Name())
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE keys (i BIGINT, b BLOB)")
+	require.NoError(t, err)
+
+	v := NewEncoder(11, 13).Encode(0xFFFFFFFF)
+	_, err = db.Exec("INSERT INTO keys VALUES (?, ?)", v, Column(&v, keysql.Bytes))
+	require.NoError(t, err)
+
+	var i, b Value
+	require.NoError(t, db.QueryRow("SELECT * FROM keys").Scan(&i, Column(&b, keysql.Bytes)))
+	require.Equal(t, v, i)
+	require.Equal(t, v, b)
+
+	// a 32-bit key is stored as a non-negative BIGINT
+	dv, err := v.Value()
+	require.NoError(t, err)
+	require.Equal(t, int64(0xFFFFFFFF), dv)
+}
+
+func TestTextFormats(t *testing.T) {
+	enc := NewEncoder(8, 8)
+	v := Value(0x6A123478)
+
+	for format, want := range map[TextFormat]string{
+		Decimal: "1779577976",
+		Hex:     "6a-123478",
+		Base32:  "1N14D3R",
+	} {
+		c := NewTextCodec(enc, format)
+		require.Equal(t, want, c.Format(v), format.String())
+		got, err := c.Parse(want)
+		require.NoError(t, err)
+		require.Equal(t, v, got)
+	}
+
+	// the leading base32 symbol only carries two bits
+	_, err := NewTextCodec(enc, Base32).Parse("8000000")
+	require.Error(t, err)
+
+	// every 32-bit Value fits a JSON number, so JSON keeps them numeric
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	require.Equal(t, `1779577976`, string(b))
+	var back Value
+	require.NoError(t, json.Unmarshal(b, &back))
+	require.Equal(t, v, back)
+	require.NoError(t, json.Unmarshal([]byte(`"1779577976"`), &back))
+	require.Equal(t, v, back)
+	require.Error(t, json.Unmarshal([]byte(`"4294967296"`), &back))
+	require.Error(t, json.Unmarshal([]byte(`4294967296`), &back))
+	require.Error(t, json.Unmarshal([]byte(`1e3`), &back))
+
+	// map keys still use MarshalText
+	b, err = json.Marshal(map[Value]bool{v: true})
+	require.NoError(t, err)
+	require.Equal(t, `{"1779577976":true}`, string(b))
+}
+
+func TestEncodeAllocs(t *testing.T) {
+	enc := NewEncoder(11, 13)
+	v := uint32(0x01234567)
+	require.Zero(t, testing.AllocsPerRun(100, func() {
+		v = enc.Decode(enc.Encode(v)) + uint32(enc.Prefix(enc.Encode(v)))
+	}))
+}
+
+func BenchmarkEncode(b *testing.B) {
+	b.ReportAllocs()
+	enc := NewEncoder(11, 13)
+	var v Value
+	for i := 0; i < b.N; i++ {
+		v = enc.Encode(uint32(v) + uint32(i))
+	}
+	sink = v
+}
+
+func BenchmarkDecode(b *testing.B) {
+	b.ReportAllocs()
+	enc := NewEncoder(11, 13)
+	var v uint32
+	for i := 0; i < b.N; i++ {
+		v = enc.Decode(Value(v + uint32(i)))
+	}
+	sink = Value(v)
+}
+
+// sink keeps the compiler from discarding benchmark results.
+var sink Value
+
+func TestEncodeSlice(t *testing.T) {
+	enc := NewEncoder(11, 13)
+	src := make([]uint32, 1000)
+	for i := range src {
+		src[i] = uint32(i) * 0x9e3779b9
+	}
+	dst := make([]Value, len(src)+1)
+	enc.EncodeSlice(dst, src)
+	for i, v := range src {
+		require.Equal(t, enc.Encode(v), dst[i])
+	}
+	require.Zero(t, dst[len(src)], "EncodeSlice wrote past len(src)")
+
+	back := make([]uint32, len(src))
+	enc.DecodeSlice(back, dst[:len(src)])
+	require.Equal(t, src, back)
+
+	require.Panics(t, func() { enc.EncodeSlice(dst[:1], src) })
+	require.Panics(t, func() { enc.DecodeSlice(back[:1], dst) })
+}
+
+func TestEncodeStream(t *testing.T) {
+	enc := NewEncoder(11, 13)
+	// more than one batch, so the loop runs more than once
+	var in bytes.Buffer
+	src := make([]uint32, 1300)
+	for i := range src {
+		src[i] = uint32(i) * 0x9e3779b9
+		in.Write(binary.BigEndian.AppendUint32(nil, src[i]))
+	}
+
+	var encoded bytes.Buffer
+	n, err := EncodeStream(enc, &encoded, bytes.NewReader(in.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(src)), n)
+	for i, v := range src {
+		require.Equal(t, uint32(enc.Encode(v)), binary.BigEndian.Uint32(encoded.Bytes()[i*4:]))
+	}
+
+	var decoded bytes.Buffer
+	n, err = DecodeStream(enc, &decoded, &encoded)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(src)), n)
+	require.Equal(t, in.Bytes(), decoded.Bytes())
+
+	// a trailing partial word is reported after the whole words are written
+	var out bytes.Buffer
+	n, err = EncodeStream(enc, &out, bytes.NewReader(in.Bytes()[:2*4+1]))
+	require.ErrorIs(t, err, ErrPartialWord)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.Equal(t, int64(2), n)
+	require.Equal(t, 2*4, out.Len())
+}
+
+func BenchmarkEncodeSlice(b *testing.B) {
+	enc := NewEncoder(11, 13)
+	src := make([]uint32, 4096)
+	dst := make([]Value, len(src))
+	for i := range src {
+		src[i] = uint32(i) * 0x9e3779b9
+	}
+
+	b.Run("per-value", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(src) * 4))
+		for i := 0; i < b.N; i++ {
+			for j, v := range src {
+				dst[j] = enc.Encode(v)
+			}
+		}
+	})
+	b.Run("slice", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(src) * 4))
+		for i := 0; i < b.N; i++ {
+			enc.EncodeSlice(dst, src)
+		}
+	})
+	b.Run("stream", func(b *testing.B) {
+		in := make([]byte, len(src)*4)
+		b.ReportAllocs()
+		b.SetBytes(int64(len(in)))
+		for i := 0; i < b.N; i++ {
+			if _, err := EncodeStream(enc, io.Discard, bytes.NewReader(in)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestConformance(t *testing.T) {
+	encodertest.Run[uint32, Value](t, NewEncoderE)
+}
+
+func FuzzEncoder(f *testing.F) {
+	f.Add(uint8(11), uint8(13), uint32(0x01234567))
+	f.Add(uint8(0), uint8(32), ^uint32(0))
+	f.Add(uint8(32), uint8(0), uint32(1))
+	f.Fuzz(func(t *testing.T, offset, size uint8, v uint32) {
+		enc, err := NewEncoderE(int(offset), int(size))
+		if err != nil {
+			t.Skip()
+		}
+		encodertest.CheckValue[uint32, Value](t, enc, int(offset), int(size), v)
+	})
+}
+
+func TestBinary(t *testing.T) {
+	var _ encoding.BinaryMarshaler = Value(0)
+	var _ encoding.BinaryUnmarshaler = new(Value)
+	var _ interface{ AppendBinary([]byte) ([]byte, error) } = Value(0)
+
+	values := []Value{0, 1, 0xff, 1 << (32 - 1), ^Value(0)}
+	for i := 0; i < 64; i++ {
+		values = append(values, Value(uint32(i+1)*0x9e3779b9))
+	}
+	for _, v := range values {
+		b, err := v.MarshalBinary()
+		require.NoError(t, err)
+		require.Len(t, b, 4)
+		var got Value
+		require.NoError(t, got.UnmarshalBinary(b))
+		require.Equal(t, v, got)
+
+		// byte order is numeric order
+		for _, w := range values {
+			bw, err := w.AppendBinary([]byte{})
+			require.NoError(t, err)
+			require.Equal(t, cmp.Compare(v, w), bytes.Compare(b, bw), "%#x vs %#x", v, w)
+		}
+	}
+
+	b, err := Value(1).AppendBinary([]byte("k/"))
+	require.NoError(t, err)
+	require.Len(t, b, 2+4)
+
+	var v Value
+	require.ErrorIs(t, v.UnmarshalBinary(make([]byte, 4-1)), ErrBinaryLength)
+	require.ErrorIs(t, v.UnmarshalBinary(make([]byte, 4+1)), ErrBinaryLength)
+}
+
+func TestShardBounds(t *testing.T) {
+	enc := NewEncoder(11, 13)
+	for _, p := range []uint32{0, 1, 5077, 1<<13 - 1} {
+		start, end, err := ShardBounds(enc, p)
+		require.NoError(t, err)
+		require.Len(t, start, 4)
+		if p == 1<<13-1 {
+			require.Nil(t, end, "the last shard is unbounded above")
+		} else {
+			require.Len(t, end, 4)
+		}
+
+		for i := 0; i < 200; i++ {
+			v := enc.Encode(uint32(i) * 0x9e3779b9)
+			b, _ := v.MarshalBinary()
+			inside := bytes.Compare(start, b) <= 0 && (end == nil || bytes.Compare(b, end) < 0)
+			require.Equal(t, enc.Prefix(v) == p, inside, "value %#x prefix %d", v, enc.Prefix(v))
+		}
+	}
+
+	_, err := ShardPrefix(enc, 1)
+	require.ErrorIs(t, err, ErrUnaligned)
+	_, _, err = ShardBounds(enc, 1<<13)
+	require.ErrorIs(t, err, ErrPrefixRange)
+
+	// an 8-bit prefix is exactly the first byte
+	enc8 := NewEncoder(4, 8)
+	pfx, err := ShardPrefix(enc8, 0xa5)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xa5}, pfx)
+	b, _ := enc8.Encode(0x0a50).MarshalBinary()
+	require.True(t, bytes.HasPrefix(b, pfx))
+	_, err = ShardPrefix(enc8, 0x100)
+	require.ErrorIs(t, err, ErrPrefixRange)
+
+	// a zero-bit prefix is one shard covering everything
+	start, end, err := ShardBounds(NewEncoder(0, 0), 0)
+	require.NoError(t, err)
+	require.Equal(t, make([]byte, 4), start)
+	require.Nil(t, end)
+	pfx, err = ShardPrefix(NewEncoder(0, 0), 0)
+	require.NoError(t, err)
+	require.Empty(t, pfx)
+
+	// a full-width prefix is one value per shard
+	full := NewEncoder(0, 32)
+	start, end, err = ShardBounds(full, 7)
+	require.NoError(t, err)
+	require.Equal(t, binary.BigEndian.AppendUint32(nil, 7), start)
+	require.Equal(t, binary.BigEndian.AppendUint32(nil, 8), end)
+	_, end, err = ShardBounds(full, ^uint32(0))
+	require.NoError(t, err)
+	require.Nil(t, end)
+}
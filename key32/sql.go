@@ -0,0 +1,42 @@
+package key32
+
+import (
+	"database/sql/driver"
+
+	"github.com/sean-/go-sharded-cluster-keys/keysql"
+)
+
+// Value implements driver.Valuer, storing v in a BIGINT column
+// (keysql.Int64).  Use Column for other representations.
+func (v Value) Value() (driver.Value, error) {
+	return keysql.UintValue(uint64(v), 32, keysql.Int64)
+}
+
+// Scan implements sql.Scanner for columns written by Value.
+func (v *Value) Scan(src any) error {
+	return Column(v, keysql.Int64).Scan(src)
+}
+
+// Column returns a driver.Valuer and sql.Scanner that store *v using
+// format f, for use as a query argument or Scan destination.
+func Column(v *Value, f keysql.Format) keysql.Column {
+	return column{v: v, f: f}
+}
+
+type column struct {
+	v *Value
+	f keysql.Format
+}
+
+func (c column) Value() (driver.Value, error) {
+	return keysql.UintValue(uint64(*c.v), 32, c.f)
+}
+
+func (c column) Scan(src any) error {
+	u, err := keysql.ScanUint(src, 32, c.f)
+	if err != nil {
+		return err
+	}
+	*c.v = Value(u)
+	return nil
+}
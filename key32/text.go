@@ -0,0 +1,148 @@
+package key32
+
+import (
+	"fmt"
+
+	"github.com/sean-/go-sharded-cluster-keys/internal/textfmt"
+)
+
+// MarshalText implements encoding.TextMarshaler using unsigned decimal.
+func (v Value) MarshalText() ([]byte, error) {
+	return textfmt.AppendDecimal(nil, uint64(v)), nil
+}
+
+// MarshalJSON implements json.Marshaler.  Every 32-bit Value fits exactly
+// in a JSON number, so Values stay numbers rather than taking the quoted
+// MarshalText form.
+func (v Value) MarshalJSON() ([]byte, error) {
+	return textfmt.AppendDecimal(nil, uint64(v)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.  It accepts only the
+// output of MarshalText: no sign, no leading zeros, no separators.
+func (v *Value) UnmarshalText(text []byte) error {
+	u, err := textfmt.ParseDecimal(string(text), 32)
+	if err != nil {
+		return fmt.Errorf("key32: %w", err)
+	}
+	*v = Value(u)
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.  It accepts a JSON number or
+// a quoted decimal string, both strictly as UnmarshalText; null is a
+// no-op.
+func (v *Value) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	u, err := textfmt.ParseJSON(data, 32)
+	if err != nil {
+		return fmt.Errorf("key32: %w", err)
+	}
+	*v = Value(u)
+	return nil
+}
+
+// TextFormat selects a string representation for Values.
+type TextFormat int
+
+const (
+	// Decimal is unsigned decimal, e.g. "1779577976".
+	Decimal TextFormat = iota
+	// Hex is fixed-width lowercase hex with the PrefixHexSize() prefix
+	// nibbles split off by a '-', e.g. "6a-123478".
+	Hex
+	// Base32 is fixed-width Crockford base32, e.g. "1N14D3R".
+	Base32
+)
+
+func (f TextFormat) String() string {
+	switch f {
+	case Decimal:
+		return "decimal"
+	case Hex:
+		return "hex"
+	case Base32:
+		return "base32"
+	}
+	return fmt.Sprintf("TextFormat(%d)", int(f))
+}
+
+// TextCodec formats and strictly parses Values in one TextFormat.
+type TextCodec struct {
+	format        TextFormat
+	prefixNibbles int
+}
+
+// NewTextCodec returns a TextCodec for f.  e supplies the prefix width for
+// the Hex format and may be nil for the others.
+func NewTextCodec(e Encoder, f TextFormat) TextCodec {
+	c := TextCodec{format: f}
+	if e != nil {
+		c.prefixNibbles = e.PrefixHexSize()
+	}
+	return c
+}
+
+// AppendText appends the text form of v to dst.
+func (c TextCodec) AppendText(dst []byte, v Value) []byte {
+	switch c.format {
+	case Hex:
+		return textfmt.AppendHex(dst, uint64(v), 32, c.prefixNibbles)
+	case Base32:
+		return textfmt.AppendBase32(dst, uint64(v), 32)
+	}
+	return textfmt.AppendDecimal(dst, uint64(v))
+}
+
+// Format returns the text form of v.
+func (c TextCodec) Format(v Value) string {
+	return string(c.AppendText(nil, v))
+}
+
+// Parse parses s, rejecting anything Format would not produce (apart from
+// letter case in the Hex and Base32 formats).
+func (c TextCodec) Parse(s string) (Value, error) {
+	var u uint64
+	var err error
+	switch c.format {
+	case Hex:
+		u, err = textfmt.ParseHex(s, 32, c.prefixNibbles)
+	case Base32:
+		u, err = textfmt.ParseBase32(s, 32)
+	default:
+		u, err = textfmt.ParseDecimal(s, 32)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("key32: %w", err)
+	}
+	return Value(u), nil
+}
+
+// Text returns an encoding.TextMarshaler and encoding.TextUnmarshaler that
+// reads and writes *v in c's format, for use with encoding/json and friends.
+func (c TextCodec) Text(v *Value) *Text {
+	return &Text{v: v, codec: c}
+}
+
+// Text binds a *Value to a TextCodec; see TextCodec.Text.
+type Text struct {
+	v     *Value
+	codec TextCodec
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t *Text) MarshalText() ([]byte, error) {
+	return t.codec.AppendText(nil, *t.v), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (t *Text) UnmarshalText(text []byte) error {
+	v, err := t.codec.Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*t.v = v
+	return nil
+}
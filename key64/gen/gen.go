@@ -0,0 +1,172 @@
+// Package gen generates Snowflake-style 64-bit IDs laid out as
+// [timestamp | worker | sequence] and returns them already shard-encoded
+// with a key64.Encoder.
+package gen
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+)
+
+// Errors returned by New and Generator.Next.
+var (
+	ErrLayout        = errors.New("gen: worker and sequence bits leave no room for a timestamp")
+	ErrWorkerID      = errors.New("gen: worker ID does not fit in WorkerBits")
+	ErrClockRollback = errors.New("gen: clock moved backwards")
+	ErrTimeOverflow  = errors.New("gen: timestamp does not fit in the remaining bits")
+)
+
+// Config describes the ID layout and the environment of a Generator.
+type Config struct {
+	// Encoder shard-encodes every generated ID.  Required.
+	Encoder key64.Encoder
+
+	// Epoch is the instant timestamp zero refers to.  Defaults to the
+	// Unix epoch.
+	Epoch time.Time
+
+	// Tick is the timestamp resolution.  Defaults to one millisecond.
+	Tick time.Duration
+
+	// WorkerBits and SequenceBits size the middle and low fields; the
+	// timestamp takes the remaining 64-WorkerBits-SequenceBits bits.
+	WorkerBits   int
+	SequenceBits int
+
+	// WorkerID identifies this generator and must fit in WorkerBits.
+	WorkerID uint64
+
+	// MaxRollback is how far the clock may step backwards before Next
+	// gives up with ErrClockRollback.  Smaller rollbacks are absorbed by
+	// waiting for the clock to catch up.  Defaults to zero.
+	MaxRollback time.Duration
+
+	// Now returns the current time.  Defaults to time.Now.
+	Now func() time.Time
+
+	// Sleep pauses the calling goroutine.  Defaults to time.Sleep.
+	Sleep func(time.Duration)
+}
+
+// ID is a decoded generator output.
+type ID struct {
+	Time     time.Time
+	Worker   uint64
+	Sequence uint64
+}
+
+// Generator hands out unique, shard-encoded IDs.  It is safe for
+// concurrent use.
+type Generator struct {
+	cfg      Config
+	timeBits int
+
+	mu       sync.Mutex
+	lastTick uint64
+	sequence uint64
+}
+
+// New validates cfg and returns a Generator.
+func New(cfg Config) (*Generator, error) {
+	if cfg.Encoder == nil {
+		return nil, errors.New("gen: Config.Encoder is required")
+	}
+	if cfg.WorkerBits < 0 || cfg.SequenceBits < 0 || cfg.WorkerBits+cfg.SequenceBits >= 64 {
+		return nil, fmt.Errorf("%w: worker=%d sequence=%d", ErrLayout, cfg.WorkerBits, cfg.SequenceBits)
+	}
+	if cfg.WorkerID > mask(cfg.WorkerBits) {
+		return nil, fmt.Errorf("%w: id=%d bits=%d", ErrWorkerID, cfg.WorkerID, cfg.WorkerBits)
+	}
+	if cfg.Tick <= 0 {
+		cfg.Tick = time.Millisecond
+	}
+	if cfg.Epoch.IsZero() {
+		cfg.Epoch = time.Unix(0, 0)
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	if cfg.Sleep == nil {
+		cfg.Sleep = time.Sleep
+	}
+	return &Generator{
+		cfg:      cfg,
+		timeBits: 64 - cfg.WorkerBits - cfg.SequenceBits,
+	}, nil
+}
+
+// Next returns the next ID, shard-encoded with Config.Encoder.  When the
+// sequence for the current tick is exhausted Next waits for the next tick.
+func (g *Generator) Next() (key64.Value, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	tick, err := g.now()
+	if err != nil {
+		return 0, err
+	}
+	for tick < g.lastTick {
+		behind := time.Duration(g.lastTick-tick) * g.cfg.Tick
+		if behind > g.cfg.MaxRollback {
+			return 0, fmt.Errorf("%w: %s behind the last issued ID", ErrClockRollback, behind)
+		}
+		g.cfg.Sleep(behind)
+		if tick, err = g.now(); err != nil {
+			return 0, err
+		}
+	}
+
+	if tick == g.lastTick {
+		g.sequence = (g.sequence + 1) & mask(g.cfg.SequenceBits)
+		if g.sequence == 0 {
+			// sequence exhausted: spin until the next tick
+			for tick <= g.lastTick {
+				g.cfg.Sleep(g.cfg.Tick / 10)
+				if tick, err = g.now(); err != nil {
+					return 0, err
+				}
+			}
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastTick = tick
+
+	id := tick<<(g.cfg.WorkerBits+g.cfg.SequenceBits) |
+		g.cfg.WorkerID<<g.cfg.SequenceBits |
+		g.sequence
+	return g.cfg.Encoder.Encode(id), nil
+}
+
+// now returns the current tick relative to the epoch.
+func (g *Generator) now() (uint64, error) {
+	since := g.cfg.Now().Sub(g.cfg.Epoch)
+	if since < 0 {
+		return 0, fmt.Errorf("%w: now is before the epoch", ErrClockRollback)
+	}
+	tick := uint64(since / g.cfg.Tick)
+	if tick > mask(g.timeBits) {
+		return 0, fmt.Errorf("%w: tick %d needs more than %d bits", ErrTimeOverflow, tick, g.timeBits)
+	}
+	return tick, nil
+}
+
+// Parse decodes v and splits it into its timestamp, worker and sequence.
+func (g *Generator) Parse(v key64.Value) ID {
+	id := g.cfg.Encoder.Decode(v)
+	tick := id >> (g.cfg.WorkerBits + g.cfg.SequenceBits)
+	return ID{
+		Time:     g.cfg.Epoch.Add(time.Duration(tick) * g.cfg.Tick),
+		Worker:   (id >> g.cfg.SequenceBits) & mask(g.cfg.WorkerBits),
+		Sequence: id & mask(g.cfg.SequenceBits),
+	}
+}
+
+// mask returns a uint64 with the low n bits set.
+func mask(n int) uint64 {
+	return 1<<n - 1
+}
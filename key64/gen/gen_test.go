@@ -0,0 +1,157 @@
+package gen
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+)
+
+// fakeClock is a manually advanced clock whose Sleep moves time forward.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestGenerator(t *testing.T, clock *fakeClock, maxRollback time.Duration) *Generator {
+	t.Helper()
+	g, err := New(Config{
+		Encoder:      key64.NewEncoder(22, 4),
+		Epoch:        time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		WorkerBits:   10,
+		SequenceBits: 12,
+		WorkerID:     42,
+		MaxRollback:  maxRollback,
+		Now:          clock.Now,
+		Sleep:        clock.Sleep,
+	})
+	require.NoError(t, err)
+	return g
+}
+
+func TestNextAndParse(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	g := newTestGenerator(t, clock, 0)
+
+	v1, err := g.Next()
+	require.NoError(t, err)
+	v2, err := g.Next()
+	require.NoError(t, err)
+	require.NotEqual(t, v1, v2)
+
+	id := g.Parse(v2)
+	require.Equal(t, clock.Now(), id.Time)
+	require.Equal(t, uint64(42), id.Worker)
+	require.Equal(t, uint64(1), id.Sequence)
+
+	clock.Advance(time.Millisecond)
+	v3, err := g.Next()
+	require.NoError(t, err)
+	require.Equal(t, ID{Time: clock.Now(), Worker: 42, Sequence: 0}, g.Parse(v3))
+
+	// the output is shard-encoded: decoding recovers the raw layout
+	enc := key64.NewEncoder(22, 4)
+	raw := enc.Decode(v3)
+	require.Equal(t, uint64(42), (raw>>12)&0x3ff)
+}
+
+func TestSequenceExhaustionWaitsForNextTick(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	g := newTestGenerator(t, clock, 0)
+	start := clock.Now()
+
+	seen := make(map[key64.Value]bool)
+	for i := 0; i < 1<<12+1; i++ {
+		v, err := g.Next()
+		require.NoError(t, err)
+		require.False(t, seen[v], "duplicate ID")
+		seen[v] = true
+	}
+	require.True(t, clock.Now().After(start), "generator must wait for the next tick")
+}
+
+func TestClockRollback(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)}
+	g := newTestGenerator(t, clock, 5*time.Millisecond)
+
+	_, err := g.Next()
+	require.NoError(t, err)
+
+	// a small rollback is absorbed by waiting
+	clock.Advance(-3 * time.Millisecond)
+	v, err := g.Next()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), g.Parse(v).Sequence)
+
+	// a large rollback is reported
+	clock.Advance(-time.Second)
+	_, err = g.Next()
+	require.ErrorIs(t, err, ErrClockRollback)
+}
+
+func TestNewValidates(t *testing.T) {
+	enc := key64.NewEncoder(22, 4)
+	_, err := New(Config{Encoder: enc, WorkerBits: 40, SequenceBits: 24})
+	require.ErrorIs(t, err, ErrLayout)
+	_, err = New(Config{Encoder: enc, WorkerBits: 2, SequenceBits: 12, WorkerID: 4})
+	require.ErrorIs(t, err, ErrWorkerID)
+	_, err = New(Config{WorkerBits: 2})
+	require.Error(t, err)
+
+	clock := &fakeClock{now: time.Unix(1<<20, 0)}
+	g, err := New(Config{Encoder: enc, WorkerBits: 22, SequenceBits: 22, Now: clock.Now})
+	require.NoError(t, err)
+	_, err = g.Next()
+	require.ErrorIs(t, err, ErrTimeOverflow)
+}
+
+func TestConcurrentNext(t *testing.T) {
+	g, err := New(Config{Encoder: key64.NewEncoder(22, 4), WorkerBits: 10, SequenceBits: 12})
+	require.NoError(t, err)
+
+	const workers, perWorker = 8, 500
+	out := make(chan key64.Value, workers*perWorker)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				v, err := g.Next()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				out <- v
+			}
+		}()
+	}
+	wg.Wait()
+	close(out)
+
+	seen := make(map[key64.Value]bool)
+	for v := range out {
+		require.False(t, seen[v], "duplicate ID")
+		seen[v] = true
+	}
+	require.Len(t, seen, workers*perWorker)
+}
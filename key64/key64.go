@@ -3,6 +3,12 @@
 // and prepending them into the high bits of a 64-bit word.
 package key64
 
+import (
+	"fmt"
+
+	"github.com/sean-/go-sharded-cluster-keys/keybits"
+)
+
 // Value is the encoded form produced by Encoder.Encode.
 type Value uint64
 
@@ -35,95 +41,133 @@ type Encoder interface {
 
 	// EncodedBits returns the number of bits in Value
 	EncodedBits() int
+
+	// EncodedRanges returns the minimal sorted set of encoded ranges
+	// covering exactly the original values in [lo, hi].
+	EncodedRanges(lo, hi uint64) []Range
+
+	// EncodeSlice encodes src into dst, which must be at least as long
+	// as src.  It is Encode without a dynamic call per element.
+	EncodeSlice(dst []Value, src []uint64)
+
+	// DecodeSlice decodes src into dst, which must be at least as long
+	// as src.
+	DecodeSlice(dst []uint64, src []Value)
+}
+
+// Range is an inclusive interval [Lo, Hi] of encoded values, as returned
+// by Encoder.EncodedRanges.  Both bounds are inclusive so that the top of
+// the keyspace is representable.
+type Range struct {
+	Lo, Hi Value
 }
 
 // encoder is the concrete implementation of Encoder.
 type encoder struct {
-	offset    int // number of low bits to leave untouched
-	size      int // size of the “shard” segment
-	hexDigits int // number of hex nibbles in the prefix
+	bits keybits.Encoder[uint64]
 }
 
-const valueBits = 64
-
 // NewEncoder constructs an Encoder that will extract `size` bits
 // starting at bit `offset` (0 = LSB), reverse them, and prepend into
-// the top `size` bits.
+// the top `size` bits. The layout is not validated; use NewEncoderE
+// when offset and size come from configuration.
 func NewEncoder(offset, size int) Encoder {
-	return encoder{
-		offset:    offset,
-		size:      size,
-		hexDigits: (size + 3) / 4,
+	return encoder{bits: keybits.NewEncoder[uint64](offset, size)}
+}
+
+// Errors returned by NewEncoderE for layouts that cannot be encoded.
+// They are the keybits sentinels, so errors.Is matches either name;
+// NewEncoderE prefixes the message with "key64: ".
+var (
+	ErrNegativeOffset = keybits.ErrNegativeOffset
+	ErrNegativeSize   = keybits.ErrNegativeSize
+	ErrLayoutOverflow = keybits.ErrLayoutOverflow
+)
+
+// NewEncoderE is like NewEncoder but rejects layouts whose shard segment
+// does not fit inside a 64-bit word.
+func NewEncoderE(offset, size int) (Encoder, error) {
+	bits := keybits.NewEncoder[uint64](offset, size)
+	if err := bits.Validate(); err != nil {
+		return nil, fmt.Errorf("key64: %w", err)
+	}
+	return encoder{bits: bits}, nil
+}
+
+// MustNewEncoder is like NewEncoderE but panics if the layout is invalid.
+func MustNewEncoder(offset, size int) Encoder {
+	e, err := NewEncoderE(offset, size)
+	if err != nil {
+		panic(err)
 	}
+	return e
 }
 
-func (e encoder) LeftSize() int   { return e.offset }
-func (e encoder) PrefixSize() int { return e.size }
-func (e encoder) RightSize() int  { return valueBits - e.offset - e.size }
+func (e encoder) LeftSize() int   { return e.bits.LeftSize() }
+func (e encoder) PrefixSize() int { return e.bits.PrefixSize() }
+func (e encoder) RightSize() int  { return e.bits.RightSize() }
 
 // Encode implements Encoder.Encode
 func (e encoder) Encode(v uint64) Value {
-	// 1) extract the size-bit field
-	mask := uint64((1 << e.size) - 1)
-	field := (v >> e.offset) & mask
-
-	// 2) reverse its bits
-	rev := reverseBits(field, e.size)
-
-	// 3) split out the untouched chunks
-	left := v >> (e.offset + e.size)
-	right := v & ((1 << e.offset) - 1)
-
-	// 4) reassemble: [rev-pfx | left | right]
-	enc := (rev << (valueBits - e.size)) | (left << e.offset) | right
-	return Value(enc)
+	return Value(e.bits.Encode(v))
 }
 
 // Decode implements Encoder.Decode
 func (e encoder) Decode(val Value) uint64 {
-	u := uint64(val)
-	mask := uint64((1 << e.size) - 1)
-
-	// 1) pull out and unreversed the top size bits
-	rev := (u >> (valueBits - e.size)) & mask
-	field := reverseBits(rev, e.size)
+	return e.bits.Decode(uint64(val))
+}
 
-	// 2) split the rest
-	left := (u >> e.offset) & ((1 << (valueBits - e.size - e.offset)) - 1)
-	right := u & ((1 << e.offset) - 1)
+// EncodeSlice implements Encoder.EncodeSlice
+func (e encoder) EncodeSlice(dst []Value, src []uint64) {
+	if len(dst) < len(src) {
+		panic("key64: EncodeSlice: dst shorter than src")
+	}
+	dst = dst[:len(src)]
+	for i, v := range src {
+		dst[i] = Value(e.bits.Encode(v))
+	}
+}
 
-	// 3) rebuild original
-	return (left << (e.offset + e.size)) | (field << e.offset) | right
+// DecodeSlice implements Encoder.DecodeSlice
+func (e encoder) DecodeSlice(dst []uint64, src []Value) {
+	if len(dst) < len(src) {
+		panic("key64: DecodeSlice: dst shorter than src")
+	}
+	dst = dst[:len(src)]
+	for i, v := range src {
+		dst[i] = e.bits.Decode(uint64(v))
+	}
 }
 
 // Prefix implements Encoder.Prefix
 func (e encoder) Prefix(val Value) uint64 {
-	u := uint64(val)
-	return (u >> (valueBits - e.size)) & ((1 << e.size) - 1)
+	return e.bits.Prefix(uint64(val))
 }
 
 // PrefixHexPad implements Encoder.PrefixHexPad
 func (e encoder) PrefixHexPad(prefix uint64) uint64 {
-	// shift prefix so its MSB lands at the MSB of the nibble block
-	return prefix << (e.hexDigits*4 - e.size)
+	return e.bits.PrefixHexPad(prefix)
 }
 
 // EncodedBits returns the number of bits in Value
 func (e encoder) EncodedBits() int {
-	return valueBits
+	return e.bits.EncodedBits()
 }
 
 // PrefixHexSize returns the number of hex nibbles required for a given prefix
 func (e encoder) PrefixHexSize() int {
-	return (e.size + 3) / 4
+	return e.bits.PrefixHexSize()
 }
 
-// reverseBits reverses the low bitCount bits of x.
-func reverseBits(x uint64, bitCount int) uint64 {
-	var out uint64
-	for i := 0; i < bitCount; i++ {
-		out <<= 1
-		out |= (x >> i) & 1
+// EncodedRanges implements Encoder.EncodedRanges
+func (e encoder) EncodedRanges(lo, hi uint64) []Range {
+	ranges := e.bits.EncodedRanges(lo, hi)
+	if len(ranges) == 0 {
+		return nil
+	}
+	out := make([]Range, len(ranges))
+	for i, r := range ranges {
+		out[i] = Range{Lo: Value(r.Lo), Hi: Value(r.Hi)}
 	}
 	return out
 }
@@ -1,9 +1,22 @@
 package key64
 
 import (
+	"bytes"
+	"cmp"
+	"database/sql"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/sean-/go-sharded-cluster-keys/encodertest"
+	"github.com/sean-/go-sharded-cluster-keys/internal/memdb"
+	"github.com/sean-/go-sharded-cluster-keys/keysql"
 )
 
 func TestEncoder64_TableDriven(t *testing.T) {
@@ -91,3 +104,395 @@ func TestEncoder64_TableDriven(t *testing.T) {
 		})
 	}
 }
+
+func TestNewEncoderE(t *testing.T) {
+	tests := []struct {
+		name         string
+		offset, size int
+		wantErr      error
+	}{
+		{name: "valid", offset: 11, size: 13},
+		{name: "empty-prefix", offset: 64, size: 0},
+		{name: "full-width", offset: 0, size: 64},
+		{name: "negative-offset", offset: -1, size: 4, wantErr: ErrNegativeOffset},
+		{name: "negative-size", offset: 4, size: -1, wantErr: ErrNegativeSize},
+		{name: "overflow", offset: 60, size: 5, wantErr: ErrLayoutOverflow},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			enc, err := NewEncoderE(tc.offset, tc.size)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				require.True(t, strings.HasPrefix(err.Error(), "key64: "), err.Error())
+				require.Nil(t, enc)
+				require.Panics(t, func() { MustNewEncoder(tc.offset, tc.size) })
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.offset, enc.LeftSize(), "LeftSize")
+			require.Equal(t, tc.size, enc.PrefixSize(), "PrefixSize")
+			require.NotPanics(t, func() { MustNewEncoder(tc.offset, tc.size) })
+		})
+	}
+}
+
+func TestEncodedRanges(t *testing.T) {
+	enc := NewEncoder(11, 4)
+
+	// one second worth of millisecond timestamps starting at an unaligned value
+	lo := uint64(0x018f14e08f0a)
+	hi := lo + 999
+	ranges := enc.EncodedRanges(lo, hi)
+	require.NotEmpty(t, ranges)
+	require.LessOrEqual(t, len(ranges), 1<<enc.PrefixSize())
+
+	var total uint64
+	for i, r := range ranges {
+		if i > 0 {
+			require.Greater(t, uint64(r.Lo), uint64(ranges[i-1].Hi)+1, "ranges must be sorted and disjoint")
+		}
+		total += uint64(r.Hi-r.Lo) + 1
+		for _, v := range []Value{r.Lo, r.Hi} {
+			dec := enc.Decode(v)
+			require.GreaterOrEqual(t, dec, lo)
+			require.LessOrEqual(t, dec, hi)
+		}
+	}
+	require.Equal(t, hi-lo+1, total, "ranges must cover exactly the original values")
+
+	require.Nil(t, enc.EncodedRanges(hi, lo))
+}
+
+func TestSQLRoundTrip(t *testing.T) {
+	db, err := sql.Open(memdb.DriverName, t.Name())
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE keys (i BIGINT, b BLOB, s TEXT)")
+	require.NoError(t, err)
+
+	enc := NewEncoder(11, 13)
+	want := []Value{enc.Encode(0), enc.Encode(0x0123456789ABCDEF), enc.Encode(math.MaxUint64)}
+	for _, v := range want {
+		v := v
+		_, err = db.Exec("INSERT INTO keys VALUES (?, ?, ?)",
+			v, Column(&v, keysql.Bytes), Column(&v, keysql.Text))
+		require.NoError(t, err)
+	}
+
+	rows, err := db.Query("SELECT * FROM keys")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var got []Value
+	for rows.Next() {
+		var i, b, s Value
+		require.NoError(t, rows.Scan(&i, Column(&b, keysql.Bytes), Column(&s, keysql.Text)))
+		require.Equal(t, i, b)
+		require.Equal(t, i, s)
+		got = append(got, i)
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, want, got)
+}
+
+func TestTextFormats(t *testing.T) {
+	enc := NewEncoder(11, 13)
+	v := Value(0xB30123456789ABEF)
+
+	tests := []struct {
+		format TextFormat
+		want   string
+		bad    []string
+	}{
+		{Decimal, "12898629588762602479", []string{"", "+1", "012", "1_000", "18446744073709551616", " 1"}},
+		{Hex, "b301-23456789abef", []string{"b30123456789abef", "b30-123456789abef", "b301-23456789abeg", "b301-23456789abe"}},
+		{Base32, "B60938NKRKAZF", []string{"B60938NKRKAZ", "G60938NKRKAZF", "B60938NKRKAZU", "B60938NKRKAZL"}},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.format.String(), func(t *testing.T) {
+			c := NewTextCodec(enc, tc.format)
+			require.Equal(t, tc.want, c.Format(v))
+
+			got, err := c.Parse(tc.want)
+			require.NoError(t, err)
+			require.Equal(t, v, got)
+
+			for _, s := range tc.bad {
+				_, err := c.Parse(s)
+				require.Errorf(t, err, "Parse(%q) should fail", s)
+			}
+		})
+	}
+
+	// case-insensitive where the alphabet allows it
+	got, err := NewTextCodec(enc, Base32).Parse("b60938nkrkazf")
+	require.NoError(t, err)
+	require.Equal(t, v, got)
+}
+
+func TestJSON(t *testing.T) {
+	type row struct {
+		ID Value `json:"id"`
+	}
+	v := Value(math.MaxUint64)
+
+	b, err := json.Marshal(row{ID: v})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"id":"18446744073709551615"}`, string(b))
+
+	var r row
+	require.NoError(t, json.Unmarshal(b, &r))
+	require.Equal(t, v, r.ID)
+
+	// bare numbers from older payloads still decode
+	require.NoError(t, json.Unmarshal([]byte(`{"id":42}`), &r))
+	require.Equal(t, Value(42), r.ID)
+	require.NoError(t, json.Unmarshal([]byte(`{"id":18446744073709551615}`), &r))
+	require.Equal(t, v, r.ID)
+	require.Error(t, json.Unmarshal([]byte(`{"id":"-1"}`), &r))
+	require.Error(t, json.Unmarshal([]byte(`{"id":-1}`), &r))
+	require.Error(t, json.Unmarshal([]byte(`{"id":4.2e1}`), &r))
+	require.Error(t, json.Unmarshal([]byte(`{"id":"042"}`), &r))
+
+	// a codec-bound Text picks the format
+	c := NewTextCodec(NewEncoder(11, 13), Hex)
+	b, err = json.Marshal(c.Text(&v))
+	require.NoError(t, err)
+	require.Equal(t, `"ffff-ffffffffffff"`, string(b))
+
+	var back Value
+	require.NoError(t, json.Unmarshal([]byte(`"0000-000000000001"`), c.Text(&back)))
+	require.Equal(t, Value(1), back)
+}
+
+func TestEncodeAllocs(t *testing.T) {
+	enc := NewEncoder(11, 13)
+	v := uint64(0x01234567)
+	require.Zero(t, testing.AllocsPerRun(100, func() {
+		v = enc.Decode(enc.Encode(v)) + uint64(enc.Prefix(enc.Encode(v)))
+	}))
+}
+
+func BenchmarkEncode(b *testing.B) {
+	b.ReportAllocs()
+	enc := NewEncoder(11, 13)
+	var v Value
+	for i := 0; i < b.N; i++ {
+		v = enc.Encode(uint64(v) + uint64(i))
+	}
+	sink = v
+}
+
+func BenchmarkDecode(b *testing.B) {
+	b.ReportAllocs()
+	enc := NewEncoder(11, 13)
+	var v uint64
+	for i := 0; i < b.N; i++ {
+		v = enc.Decode(Value(v + uint64(i)))
+	}
+	sink = Value(v)
+}
+
+// sink keeps the compiler from discarding benchmark results.
+var sink Value
+
+func TestEncodeSlice(t *testing.T) {
+	enc := NewEncoder(11, 13)
+	src := make([]uint64, 1000)
+	for i := range src {
+		src[i] = uint64(i) * 0x9e3779b9
+	}
+	dst := make([]Value, len(src)+1)
+	enc.EncodeSlice(dst, src)
+	for i, v := range src {
+		require.Equal(t, enc.Encode(v), dst[i])
+	}
+	require.Zero(t, dst[len(src)], "EncodeSlice wrote past len(src)")
+
+	back := make([]uint64, len(src))
+	enc.DecodeSlice(back, dst[:len(src)])
+	require.Equal(t, src, back)
+
+	require.Panics(t, func() { enc.EncodeSlice(dst[:1], src) })
+	require.Panics(t, func() { enc.DecodeSlice(back[:1], dst) })
+}
+
+func TestEncodeStream(t *testing.T) {
+	enc := NewEncoder(11, 13)
+	// more than one batch, so the loop runs more than once
+	var in bytes.Buffer
+	src := make([]uint64, 1300)
+	for i := range src {
+		src[i] = uint64(i) * 0x9e3779b9
+		in.Write(binary.BigEndian.AppendUint64(nil, src[i]))
+	}
+
+	var encoded bytes.Buffer
+	n, err := EncodeStream(enc, &encoded, bytes.NewReader(in.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(src)), n)
+	for i, v := range src {
+		require.Equal(t, uint64(enc.Encode(v)), binary.BigEndian.Uint64(encoded.Bytes()[i*8:]))
+	}
+
+	var decoded bytes.Buffer
+	n, err = DecodeStream(enc, &decoded, &encoded)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(src)), n)
+	require.Equal(t, in.Bytes(), decoded.Bytes())
+
+	// a trailing partial word is reported after the whole words are written
+	var out bytes.Buffer
+	n, err = EncodeStream(enc, &out, bytes.NewReader(in.Bytes()[:2*8+1]))
+	require.ErrorIs(t, err, ErrPartialWord)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.Equal(t, int64(2), n)
+	require.Equal(t, 2*8, out.Len())
+}
+
+func BenchmarkEncodeSlice(b *testing.B) {
+	enc := NewEncoder(11, 13)
+	src := make([]uint64, 4096)
+	dst := make([]Value, len(src))
+	for i := range src {
+		src[i] = uint64(i) * 0x9e3779b9
+	}
+
+	b.Run("per-value", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(src) * 8))
+		for i := 0; i < b.N; i++ {
+			for j, v := range src {
+				dst[j] = enc.Encode(v)
+			}
+		}
+	})
+	b.Run("slice", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(src) * 8))
+		for i := 0; i < b.N; i++ {
+			enc.EncodeSlice(dst, src)
+		}
+	})
+	b.Run("stream", func(b *testing.B) {
+		in := make([]byte, len(src)*8)
+		b.ReportAllocs()
+		b.SetBytes(int64(len(in)))
+		for i := 0; i < b.N; i++ {
+			if _, err := EncodeStream(enc, io.Discard, bytes.NewReader(in)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestConformance(t *testing.T) {
+	encodertest.Run[uint64, Value](t, NewEncoderE)
+}
+
+func FuzzEncoder(f *testing.F) {
+	f.Add(uint8(11), uint8(13), uint64(0x01234567))
+	f.Add(uint8(0), uint8(64), ^uint64(0))
+	f.Add(uint8(64), uint8(0), uint64(1))
+	f.Fuzz(func(t *testing.T, offset, size uint8, v uint64) {
+		enc, err := NewEncoderE(int(offset), int(size))
+		if err != nil {
+			t.Skip()
+		}
+		encodertest.CheckValue[uint64, Value](t, enc, int(offset), int(size), v)
+	})
+}
+
+func TestBinary(t *testing.T) {
+	var _ encoding.BinaryMarshaler = Value(0)
+	var _ encoding.BinaryUnmarshaler = new(Value)
+	var _ interface{ AppendBinary([]byte) ([]byte, error) } = Value(0)
+
+	values := []Value{0, 1, 0xff, 1 << (64 - 1), ^Value(0)}
+	for i := 0; i < 64; i++ {
+		values = append(values, Value(uint64(i+1)*0x9e3779b9))
+	}
+	for _, v := range values {
+		b, err := v.MarshalBinary()
+		require.NoError(t, err)
+		require.Len(t, b, 8)
+		var got Value
+		require.NoError(t, got.UnmarshalBinary(b))
+		require.Equal(t, v, got)
+
+		// byte order is numeric order
+		for _, w := range values {
+			bw, err := w.AppendBinary([]byte{})
+			require.NoError(t, err)
+			require.Equal(t, cmp.Compare(v, w), bytes.Compare(b, bw), "%#x vs %#x", v, w)
+		}
+	}
+
+	b, err := Value(1).AppendBinary([]byte("k/"))
+	require.NoError(t, err)
+	require.Len(t, b, 2+8)
+
+	var v Value
+	require.ErrorIs(t, v.UnmarshalBinary(make([]byte, 8-1)), ErrBinaryLength)
+	require.ErrorIs(t, v.UnmarshalBinary(make([]byte, 8+1)), ErrBinaryLength)
+}
+
+func TestShardBounds(t *testing.T) {
+	enc := NewEncoder(11, 13)
+	for _, p := range []uint64{0, 1, 5077, 1<<13 - 1} {
+		start, end, err := ShardBounds(enc, p)
+		require.NoError(t, err)
+		require.Len(t, start, 8)
+		if p == 1<<13-1 {
+			require.Nil(t, end, "the last shard is unbounded above")
+		} else {
+			require.Len(t, end, 8)
+		}
+
+		for i := 0; i < 200; i++ {
+			v := enc.Encode(uint64(i) * 0x9e3779b9)
+			b, _ := v.MarshalBinary()
+			inside := bytes.Compare(start, b) <= 0 && (end == nil || bytes.Compare(b, end) < 0)
+			require.Equal(t, enc.Prefix(v) == p, inside, "value %#x prefix %d", v, enc.Prefix(v))
+		}
+	}
+
+	_, err := ShardPrefix(enc, 1)
+	require.ErrorIs(t, err, ErrUnaligned)
+	_, _, err = ShardBounds(enc, 1<<13)
+	require.ErrorIs(t, err, ErrPrefixRange)
+
+	// an 8-bit prefix is exactly the first byte
+	enc8 := NewEncoder(4, 8)
+	pfx, err := ShardPrefix(enc8, 0xa5)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xa5}, pfx)
+	b, _ := enc8.Encode(0x0a50).MarshalBinary()
+	require.True(t, bytes.HasPrefix(b, pfx))
+	_, err = ShardPrefix(enc8, 0x100)
+	require.ErrorIs(t, err, ErrPrefixRange)
+
+	// a zero-bit prefix is one shard covering everything
+	start, end, err := ShardBounds(NewEncoder(0, 0), 0)
+	require.NoError(t, err)
+	require.Equal(t, make([]byte, 8), start)
+	require.Nil(t, end)
+	pfx, err = ShardPrefix(NewEncoder(0, 0), 0)
+	require.NoError(t, err)
+	require.Empty(t, pfx)
+
+	// a full-width prefix is one value per shard
+	full := NewEncoder(0, 64)
+	start, end, err = ShardBounds(full, 7)
+	require.NoError(t, err)
+	require.Equal(t, binary.BigEndian.AppendUint64(nil, 7), start)
+	require.Equal(t, binary.BigEndian.AppendUint64(nil, 8), end)
+	_, end, err = ShardBounds(full, ^uint64(0))
+	require.NoError(t, err)
+	require.Nil(t, end)
+}
@@ -0,0 +1,46 @@
+package key64
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/sean-/go-sharded-cluster-keys/internal/wordstream"
+)
+
+// ErrPartialWord is returned by EncodeStream and DecodeStream when the
+// input ends part way through an 8-byte word.  It wraps io.ErrUnexpectedEOF.
+var ErrPartialWord = wordstream.ErrPartialWord
+
+// EncodeStream reads big-endian 8-byte original values from r until EOF,
+// encodes them with enc and writes them to w in the same form.  It returns
+// the number of values written.
+func EncodeStream(enc Encoder, w io.Writer, r io.Reader) (int64, error) {
+	var src [wordstream.Batch]uint64
+	var dst [wordstream.Batch]Value
+	return wordstream.Copy(w, r, 8, func(words []byte) {
+		n := len(words) / 8
+		for i := range n {
+			src[i] = binary.BigEndian.Uint64(words[i*8:])
+		}
+		enc.EncodeSlice(dst[:n], src[:n])
+		for i := range n {
+			binary.BigEndian.PutUint64(words[i*8:], uint64(dst[i]))
+		}
+	})
+}
+
+// DecodeStream is the inverse of EncodeStream.
+func DecodeStream(enc Encoder, w io.Writer, r io.Reader) (int64, error) {
+	var src [wordstream.Batch]Value
+	var dst [wordstream.Batch]uint64
+	return wordstream.Copy(w, r, 8, func(words []byte) {
+		n := len(words) / 8
+		for i := range n {
+			src[i] = Value(binary.BigEndian.Uint64(words[i*8:]))
+		}
+		enc.DecodeSlice(dst[:n], src[:n])
+		for i := range n {
+			binary.BigEndian.PutUint64(words[i*8:], dst[i])
+		}
+	})
+}
@@ -0,0 +1,163 @@
+// Package keybits provides the generic bit-shuffling core shared by key32
+// and key64: extracting a run of bits, reversing them, and prepending them
+// into the high bits of a 16-, 32- or 64-bit word.  Uint128 and Encoder128
+// provide the same transform for 128-bit integer keys.
+package keybits
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// Unsigned is the set of word types an Encoder can operate on.
+type Unsigned interface {
+	~uint16 | ~uint32 | ~uint64
+}
+
+// Errors returned by Validate for layouts that cannot be encoded.
+var (
+	ErrNegativeOffset = errors.New("keybits: negative offset")
+	ErrNegativeSize   = errors.New("keybits: negative size")
+	ErrLayoutOverflow = errors.New("keybits: offset+size exceeds word width")
+)
+
+// Bits returns the width in bits of T.
+func Bits[T Unsigned]() int {
+	return bits.Len64(uint64(^T(0)))
+}
+
+// Encoder extracts `size` bits starting at bit `offset` (0 = LSB) of a
+// width-bit word, reverses them, and prepends them into the top `size`
+// bits of that word.  The zero Encoder is the identity over a 0-bit word
+// and is not useful; construct one with NewEncoder or NewEncoderWidth.
+type Encoder[T Unsigned] struct {
+	width     int // number of low bits of T that carry the value
+	offset    int // number of low bits to leave untouched
+	size      int // size of the “shard” segment
+	hexDigits int // number of hex nibbles in the prefix
+
+	// precomputed by NewEncoderWidth so Encode and Decode are a fixed
+	// sequence of shifts and masks
+	fieldMask   T    // low size bits
+	leftMask    T    // low width-offset-size bits
+	rightMask   T    // low offset bits
+	offsetShift uint // offset
+	leftShift   uint // offset + size
+	prefixShift uint // width - size
+	reverseTail uint // 64 - size: bits.Reverse64 leaves the field this far up
+}
+
+// NewEncoder constructs an Encoder over the full width of T.  The layout
+// is not validated; call Validate when offset and size are untrusted.
+func NewEncoder[T Unsigned](offset, size int) Encoder[T] {
+	return NewEncoderWidth[T](Bits[T](), offset, size)
+}
+
+// NewEncoderWidth constructs an Encoder over the low `width` bits of T.
+// Values passed to Encode must fit in width bits.  The layout is not
+// validated; call Validate when width, offset and size are untrusted.
+func NewEncoderWidth[T Unsigned](width, offset, size int) Encoder[T] {
+	e := Encoder[T]{
+		width:     width,
+		offset:    offset,
+		size:      size,
+		hexDigits: (size + 3) / 4,
+	}
+	if e.Validate() != nil {
+		// leave the masks and shifts zero: Encode, Decode and Prefix of
+		// an invalid layout return zero rather than panicking on a
+		// negative shift
+		return e
+	}
+	e.fieldMask = mask[T](size)
+	e.leftMask = mask[T](width - offset - size)
+	e.rightMask = mask[T](offset)
+	e.offsetShift = uint(offset)
+	e.leftShift = uint(offset + size)
+	e.prefixShift = uint(width - size)
+	e.reverseTail = uint(64 - size)
+	return e
+}
+
+// Validate reports whether the layout fits inside the encoder's width.
+func (e Encoder[T]) Validate() error {
+	switch {
+	case e.offset < 0:
+		return fmt.Errorf("%w: offset=%d", ErrNegativeOffset, e.offset)
+	case e.size < 0:
+		return fmt.Errorf("%w: size=%d", ErrNegativeSize, e.size)
+	case e.width < 0 || e.width > Bits[T]():
+		return fmt.Errorf("%w: width=%d, word is %d bits", ErrLayoutOverflow, e.width, Bits[T]())
+	case e.offset+e.size > e.width:
+		return fmt.Errorf("%w: offset=%d size=%d width=%d", ErrLayoutOverflow, e.offset, e.size, e.width)
+	}
+	return nil
+}
+
+// LeftSize is the number of LSB bits right of the prefix.
+func (e Encoder[T]) LeftSize() int { return e.offset }
+
+// PrefixSize is the width in bits of the prefix.
+func (e Encoder[T]) PrefixSize() int { return e.size }
+
+// RightSize is the number of MSB bits left of the prefix.
+func (e Encoder[T]) RightSize() int { return e.width - e.offset - e.size }
+
+// EncodedBits returns the number of bits in an encoded value.
+func (e Encoder[T]) EncodedBits() int { return e.width }
+
+// PrefixHexSize returns the number of hex nibbles required to display the prefix.
+func (e Encoder[T]) PrefixHexSize() int { return e.hexDigits }
+
+// Encode embeds v by extracting [offset..offset+size) bits,
+// reversing them, and prepending into the top size bits.
+func (e Encoder[T]) Encode(v T) T {
+	// 1) extract the size-bit field
+	field := (v >> e.offsetShift) & e.fieldMask
+
+	// 2) reverse its bits
+	rev := e.reverse(field)
+
+	// 3) split out the untouched chunks
+	left := (v >> e.leftShift) & e.leftMask
+	right := v & e.rightMask
+
+	// 4) reassemble: [rev-pfx | left | right]
+	return (rev << e.prefixShift) | (left << e.offsetShift) | right
+}
+
+// Decode is the inverse of Encode.
+func (e Encoder[T]) Decode(u T) T {
+	// 1) pull out and unreverse the top size bits
+	rev := (u >> e.prefixShift) & e.fieldMask
+	field := e.reverse(rev)
+
+	// 2) split the rest
+	left := (u >> e.offsetShift) & e.leftMask
+	right := u & e.rightMask
+
+	// 3) rebuild original
+	return (left << e.leftShift) | (field << e.offsetShift) | right
+}
+
+// Prefix extracts the top size bits of u (the reversed segment).
+func (e Encoder[T]) Prefix(u T) T {
+	return (u >> e.prefixShift) & e.fieldMask
+}
+
+// PrefixHexPad shifts prefix so its MSB lands at the MSB of the nibble block.
+func (e Encoder[T]) PrefixHexPad(prefix T) T {
+	return prefix << (e.hexDigits*4 - e.size)
+}
+
+// mask returns a T with the low n bits set.
+func mask[T Unsigned](n int) T {
+	return T(1)<<n - 1
+}
+
+// reverse reverses the low size bits of x, which must have no other bits
+// set.  A shift of 64 or more yields zero, so a zero size needs no branch.
+func (e Encoder[T]) reverse(x T) T {
+	return T(bits.Reverse64(uint64(x)) >> e.reverseTail)
+}
@@ -0,0 +1,309 @@
+package keybits
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBits(t *testing.T) {
+	require.Equal(t, 16, Bits[uint16]())
+	require.Equal(t, 32, Bits[uint32]())
+	require.Equal(t, 64, Bits[uint64]())
+}
+
+func TestEncoder16_TableDriven(t *testing.T) {
+	tests := []struct {
+		name                         string
+		orig                         uint16
+		offset, size                 int
+		wantLeft, wantPre, wantRight int
+		wantEnc                      uint16
+	}{
+		{
+			name:      "simple-4bit",
+			orig:      0x1234,
+			offset:    4,
+			size:      4,
+			wantLeft:  4,
+			wantPre:   4,
+			wantRight: 16 - 4 - 4,
+			// field = (0x1234>>4)&0xf = 0x3
+			// rev(0x3,4) = 0xc
+			// enc = 0xc<<12 | (0x1234>>8)<<4 | 0x4 = 0xc124
+			wantEnc: 0xc124,
+		},
+		{
+			name:      "fullMask-16bit",
+			orig:      0x0001,
+			offset:    0,
+			size:      16,
+			wantLeft:  0,
+			wantPre:   16,
+			wantRight: 0,
+			wantEnc:   0x8000,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			enc := NewEncoder[uint16](tc.offset, tc.size)
+			require.NoError(t, enc.Validate())
+
+			require.Equal(t, tc.wantLeft, enc.LeftSize(), "LeftSize")
+			require.Equal(t, tc.wantPre, enc.PrefixSize(), "PrefixSize")
+			require.Equal(t, tc.wantRight, enc.RightSize(), "RightSize")
+			require.Equal(t, 16, enc.EncodedBits(), "EncodedBits")
+
+			gotEnc := enc.Encode(tc.orig)
+			require.Equalf(t, tc.wantEnc, gotEnc,
+				"Encode(0x%04x) = 0x%04x; want 0x%04x", tc.orig, gotEnc, tc.wantEnc,
+			)
+			require.Equal(t, tc.orig, enc.Decode(gotEnc), "Decode")
+		})
+	}
+}
+
+func TestEncoderWidth(t *testing.T) {
+	// a 48-bit field carried in a uint64, as keyuuid does for UUIDv7
+	enc := NewEncoderWidth[uint64](48, 11, 4)
+	require.NoError(t, enc.Validate())
+	require.Equal(t, 48, enc.EncodedBits())
+	require.Equal(t, 48-11-4, enc.RightSize())
+
+	orig := uint64(0x018f14e08f0a)
+	gotEnc := enc.Encode(orig)
+	require.Zero(t, gotEnc>>48, "encoded value must stay within 48 bits")
+	require.Equal(t, (orig>>11)&0xf, enc.reverse(enc.Prefix(gotEnc)))
+	require.Equal(t, orig, enc.Decode(gotEnc))
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name                string
+		width, offset, size int
+		wantErr             error
+	}{
+		{name: "valid", width: 32, offset: 11, size: 13},
+		{name: "negative-offset", width: 32, offset: -1, size: 1, wantErr: ErrNegativeOffset},
+		{name: "negative-size", width: 32, offset: 1, size: -1, wantErr: ErrNegativeSize},
+		{name: "too-wide", width: 33, offset: 0, size: 1, wantErr: ErrLayoutOverflow},
+		{name: "overflow", width: 32, offset: 20, size: 13, wantErr: ErrLayoutOverflow},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			enc := NewEncoderWidth[uint32](tc.width, tc.offset, tc.size)
+			err := enc.Validate()
+			if tc.wantErr == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tc.wantErr)
+
+			// an invalid layout must not panic on a negative shift
+			require.Zero(t, enc.Encode(123))
+			require.Zero(t, enc.Decode(123))
+			require.Zero(t, enc.Prefix(123))
+		})
+	}
+
+	tests128 := []struct {
+		name         string
+		offset, size int
+		wantErr      error
+	}{
+		{name: "valid", offset: 60, size: 8},
+		{name: "negative-offset", offset: -1, size: 4, wantErr: ErrNegativeOffset},
+		{name: "negative-size", offset: 4, size: -1, wantErr: ErrNegativeSize},
+		{name: "overflow", offset: 100, size: 29, wantErr: ErrLayoutOverflow},
+		{name: "oversize", offset: 0, size: 200, wantErr: ErrLayoutOverflow},
+	}
+
+	u := Uint128{Hi: 0x0123456789abcdef, Lo: 0xfedcba9876543210}
+	for _, tc := range tests128 {
+		tc := tc
+		t.Run("128-"+tc.name, func(t *testing.T) {
+			enc := NewEncoder128(tc.offset, tc.size)
+			err := enc.Validate()
+			if tc.wantErr == nil {
+				require.NoError(t, err)
+				require.Equal(t, u, enc.Decode(enc.Encode(u)))
+				return
+			}
+			require.ErrorIs(t, err, tc.wantErr)
+
+			// an invalid layout must not panic on a negative shift
+			require.Zero(t, enc.Encode(u))
+			require.Zero(t, enc.Decode(u))
+			require.Zero(t, enc.Prefix(u))
+		})
+	}
+}
+
+func TestUint128Shifts(t *testing.T) {
+	u := Uint128{Hi: 0x0123456789abcdef, Lo: 0xfedcba9876543210}
+	require.Equal(t, u, u.Lsh(0))
+	require.Equal(t, u, u.Rsh(0))
+	require.Equal(t, Uint128{Hi: 0x23456789abcdeffe, Lo: 0xdcba987654321000}, u.Lsh(8))
+	require.Equal(t, Uint128{Hi: 0x000123456789abcd, Lo: 0xeffedcba98765432}, u.Rsh(8))
+	require.Equal(t, Uint128{Hi: u.Lo}, u.Lsh(64))
+	require.Equal(t, Uint128{Lo: u.Hi}, u.Rsh(64))
+	require.Equal(t, Uint128{}, u.Lsh(128))
+	require.Equal(t, Uint128{}, u.Rsh(128))
+	require.Equal(t, "0123456789abcdeffedcba9876543210", u.String())
+	require.Equal(t, 1, u.Cmp(Uint128From(^uint64(0))))
+
+	b := u.Bytes()
+	require.Equal(t, [16]byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0xfe, 0xdc, 0xba, 0x98, 0x76, 0x54, 0x32, 0x10}, b)
+	require.Equal(t, u, Uint128FromBytes(b))
+	require.Equal(t, Uint128{Hi: 0xff, Lo: ^uint64(0)}, Mask128(72))
+	require.Equal(t, Uint128From(0b0011), Reverse128(Uint128From(0b1100), 4))
+}
+
+func TestEncoder128(t *testing.T) {
+	orig := Uint128{Hi: 0x0123456789abcdef, Lo: 0xfedcba9876543210}
+
+	// an 8-bit segment straddling the two halves
+	enc := NewEncoder128(60, 8)
+	require.NoError(t, enc.Validate())
+	require.Equal(t, 60, enc.LeftSize())
+	require.Equal(t, 8, enc.PrefixSize())
+	require.Equal(t, 128-60-8, enc.RightSize())
+	require.Equal(t, 2, enc.PrefixHexSize())
+
+	gotEnc := enc.Encode(orig)
+	// field = bits [60,68) = 0xf (from Hi) <<4 | 0xf (from Lo) = 0xff
+	require.Equal(t, Uint128From(0xff), enc.Prefix(gotEnc))
+	require.Equal(t, orig, enc.Decode(gotEnc))
+
+	// field = bits [0,4) = 0x0; bits [4,8) = 0x1
+	enc = NewEncoder128(4, 4)
+	gotEnc = enc.Encode(orig)
+	require.Equal(t, Uint128From(0x8), enc.Prefix(gotEnc), "rev(0x1,4) = 0x8")
+	require.Equal(t, orig, enc.Decode(gotEnc))
+}
+
+func TestEncodedRanges(t *testing.T) {
+	// brute-force every original range over a 10-bit word for a few layouts
+	layouts := []struct{ offset, size int }{
+		{0, 0}, {0, 3}, {2, 3}, {4, 2}, {7, 3}, {0, 10}, {3, 1},
+	}
+	bounds := [][2]uint16{
+		{0, 1023}, {0, 0}, {5, 5}, {1, 2}, {37, 900}, {128, 255}, {511, 512}, {1000, 1023}, {9, 8},
+	}
+
+	for _, l := range layouts {
+		enc := NewEncoderWidth[uint16](10, l.offset, l.size)
+		require.NoError(t, enc.Validate())
+		for _, b := range bounds {
+			lo, hi := b[0], b[1]
+			ranges := enc.EncodedRanges(lo, hi)
+
+			want := map[uint16]bool{}
+			for v := lo; lo <= hi && v <= hi; v++ {
+				want[enc.Encode(v)] = true
+			}
+			got := map[uint16]bool{}
+			for i, r := range ranges {
+				require.LessOrEqual(t, r.Lo, r.Hi)
+				if i > 0 {
+					// sorted and minimal: never touching the previous range
+					require.Greater(t, r.Lo, ranges[i-1].Hi+1)
+				}
+				for v := r.Lo; v <= r.Hi; v++ {
+					got[v] = true
+				}
+			}
+			require.Equalf(t, want, got, "offset=%d size=%d lo=%d hi=%d", l.offset, l.size, lo, hi)
+		}
+	}
+}
+
+func TestEncodedRangesFullWidth(t *testing.T) {
+	enc := NewEncoder[uint64](8, 8)
+	all := enc.EncodedRanges(0, ^uint64(0))
+	require.Equal(t, []Range[uint64]{{Lo: 0, Hi: ^uint64(0)}}, all)
+
+	// a single original value maps to a single encoded value
+	v := uint64(0x0123456789abcdef)
+	require.Equal(t, []Range[uint64]{{Lo: enc.Encode(v), Hi: enc.Encode(v)}}, enc.EncodedRanges(v, v))
+}
+
+// loopReverse is the bit-by-bit reversal the intrinsic version replaced.
+func loopReverse(x uint64, n int) uint64 {
+	var out uint64
+	for i := 0; i < n; i++ {
+		out = out<<1 | (x>>i)&1
+	}
+	return out
+}
+
+func TestReverseMatchesLoop(t *testing.T) {
+	x := uint64(0x9e3779b97f4a7c15)
+	for size := 0; size <= 64; size++ {
+		enc := NewEncoder[uint64](0, size)
+		for i := 0; i < 64; i++ {
+			v := (x * uint64(i+1)) & mask[uint64](size)
+			require.Equalf(t, loopReverse(v, size), enc.reverse(v), "size=%d v=%#x", size, v)
+		}
+	}
+}
+
+func TestEncodeAllocs(t *testing.T) {
+	enc := NewEncoder[uint64](11, 13)
+	enc128 := NewEncoder128(11, 13)
+	v := uint64(0x0123456789abcdef)
+	w := Uint128{Hi: v, Lo: v}
+	require.Zero(t, testing.AllocsPerRun(100, func() {
+		v = enc.Decode(enc.Encode(v))
+		w = enc128.Decode(enc128.Encode(w))
+	}))
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for _, size := range []int{4, 16, 32} {
+		enc := NewEncoder[uint64](11, size)
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			var v uint64
+			for i := 0; i < b.N; i++ {
+				v = enc.Encode(v + uint64(i))
+			}
+			sink64 = v
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, size := range []int{4, 16, 32} {
+		enc := NewEncoder[uint64](11, size)
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			var v uint64
+			for i := 0; i < b.N; i++ {
+				v = enc.Decode(v + uint64(i))
+			}
+			sink64 = v
+		})
+	}
+}
+
+func BenchmarkEncode128(b *testing.B) {
+	b.ReportAllocs()
+	enc := NewEncoder128(11, 16)
+	var v Uint128
+	for i := 0; i < b.N; i++ {
+		v = enc.Encode(Uint128{Hi: v.Hi, Lo: v.Lo + uint64(i)})
+	}
+	sink128 = v
+}
+
+// sinks keep the compiler from discarding benchmark results.
+var (
+	sink64  uint64
+	sink128 Uint128
+)
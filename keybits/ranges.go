@@ -0,0 +1,85 @@
+package keybits
+
+// Range is an inclusive interval [Lo, Hi] of encoded values.  Both bounds
+// are inclusive so that the top of the keyspace is representable.
+type Range[T Unsigned] struct {
+	Lo, Hi T
+}
+
+// EncodedRanges returns the minimal, sorted set of encoded intervals whose
+// union is exactly the image under Encode of the original values in
+// [lo, hi] (inclusive).  Because Encode moves reversed bits to the top, a
+// contiguous original range generally becomes one interval per shard
+// prefix, so the result holds at most 2^PrefixSize() ranges and the cost
+// is proportional to that.
+func (e Encoder[T]) EncodedRanges(lo, hi T) []Range[T] {
+	top := mask[T](e.width)
+	if hi > top {
+		hi = top
+	}
+	if lo > hi {
+		return nil
+	}
+
+	maxH := mask[T](e.width - e.offset - e.size)
+	maxR := mask[T](e.offset)
+	maxP := mask[T](e.size)
+
+	// split both bounds into [H | F | R] as laid out in the original value
+	hl, fl, rl := e.split(lo)
+	hh, fh, rh := e.split(hi)
+
+	var out []Range[T]
+	for p := T(0); ; p++ {
+		f := e.reverse(p)
+
+		// smallest (H, R) with (H, f, R) >= lo
+		hMin, rMin := hl, T(0)
+		switch {
+		case f == fl:
+			rMin = rl
+		case f < fl:
+			hMin++
+		}
+		// largest (H, R) with (H, f, R) <= hi
+		hMax, rMax := hh, maxR
+		switch {
+		case f == fh:
+			rMax = rh
+		case f > fh:
+			hMax--
+		}
+
+		empty := (f < fl && hl == maxH) || (f > fh && hh == 0) ||
+			hMin > hMax || (hMin == hMax && rMin > rMax)
+		if !empty {
+			r := Range[T]{
+				Lo: e.join(p, hMin, rMin),
+				Hi: e.join(p, hMax, rMax),
+			}
+			if n := len(out); n > 0 && out[n-1].Hi+1 == r.Lo {
+				out[n-1].Hi = r.Hi
+			} else {
+				out = append(out, r)
+			}
+		}
+
+		if p == maxP {
+			break
+		}
+	}
+	return out
+}
+
+// split breaks an original value into its [left | field | right] chunks.
+func (e Encoder[T]) split(v T) (left, field, right T) {
+	left = (v >> (e.offset + e.size)) & mask[T](e.width-e.offset-e.size)
+	field = (v >> e.offset) & mask[T](e.size)
+	right = v & mask[T](e.offset)
+	return left, field, right
+}
+
+// join assembles an encoded value from a prefix and the untouched chunks.
+func (e Encoder[T]) join(prefix, left, right T) T {
+	return (prefix << (e.width - e.size)) | (left << e.offset) | right
+}
@@ -0,0 +1,208 @@
+package keybits
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// Uint128 is an unsigned 128-bit integer stored as two 64-bit halves.
+type Uint128 struct {
+	Hi, Lo uint64
+}
+
+// Uint128From returns the Uint128 with the given low 64 bits.
+func Uint128From(lo uint64) Uint128 { return Uint128{Lo: lo} }
+
+// Uint128FromBytes reads b as a big-endian 128-bit integer.  A uuid.UUID
+// can be passed as is.
+func Uint128FromBytes(b [16]byte) Uint128 {
+	return Uint128{Hi: binary.BigEndian.Uint64(b[0:8]), Lo: binary.BigEndian.Uint64(b[8:16])}
+}
+
+// Bytes returns u in big-endian order, the inverse of Uint128FromBytes.
+func (u Uint128) Bytes() [16]byte {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[0:8], u.Hi)
+	binary.BigEndian.PutUint64(b[8:16], u.Lo)
+	return b
+}
+
+// And returns u & v.
+func (u Uint128) And(v Uint128) Uint128 { return Uint128{u.Hi & v.Hi, u.Lo & v.Lo} }
+
+// Or returns u | v.
+func (u Uint128) Or(v Uint128) Uint128 { return Uint128{u.Hi | v.Hi, u.Lo | v.Lo} }
+
+// Xor returns u ^ v.
+func (u Uint128) Xor(v Uint128) Uint128 { return Uint128{u.Hi ^ v.Hi, u.Lo ^ v.Lo} }
+
+// Lsh returns u << n.  Shifts of 128 or more return zero.
+func (u Uint128) Lsh(n int) Uint128 {
+	switch {
+	case n >= 128:
+		return Uint128{}
+	case n >= 64:
+		return Uint128{Hi: u.Lo << (n - 64)}
+	case n == 0:
+		return u
+	}
+	return Uint128{Hi: u.Hi<<n | u.Lo>>(64-n), Lo: u.Lo << n}
+}
+
+// Rsh returns u >> n.  Shifts of 128 or more return zero.
+func (u Uint128) Rsh(n int) Uint128 {
+	switch {
+	case n >= 128:
+		return Uint128{}
+	case n >= 64:
+		return Uint128{Lo: u.Hi >> (n - 64)}
+	case n == 0:
+		return u
+	}
+	return Uint128{Hi: u.Hi >> n, Lo: u.Lo>>n | u.Hi<<(64-n)}
+}
+
+// Cmp returns -1, 0 or +1 depending on whether u is less than, equal to,
+// or greater than v.
+func (u Uint128) Cmp(v Uint128) int {
+	switch {
+	case u.Hi < v.Hi:
+		return -1
+	case u.Hi > v.Hi:
+		return 1
+	case u.Lo < v.Lo:
+		return -1
+	case u.Lo > v.Lo:
+		return 1
+	}
+	return 0
+}
+
+// String returns u as 32 zero-padded hex digits.
+func (u Uint128) String() string {
+	return fmt.Sprintf("%016x%016x", u.Hi, u.Lo)
+}
+
+// Mask128 returns a Uint128 with the low n bits set.
+func Mask128(n int) Uint128 {
+	switch {
+	case n >= 128:
+		return Uint128{^uint64(0), ^uint64(0)}
+	case n >= 64:
+		return Uint128{Hi: 1<<(n-64) - 1, Lo: ^uint64(0)}
+	}
+	return Uint128{Lo: 1<<n - 1}
+}
+
+// Reverse128 reverses the low bitCount bits of x.
+func Reverse128(x Uint128, bitCount int) Uint128 {
+	full := Uint128{Hi: bits.Reverse64(x.Lo), Lo: bits.Reverse64(x.Hi)}
+	return full.Rsh(128 - bitCount)
+}
+
+// Encoder128 is the 128-bit counterpart of Encoder, operating on Uint128.
+type Encoder128 struct {
+	offset    int // number of low bits to leave untouched
+	size      int // size of the “shard” segment
+	hexDigits int // number of hex nibbles in the prefix
+
+	// precomputed by NewEncoder128 and left zero for an invalid layout,
+	// as for Encoder
+	fieldMask   Uint128 // low size bits
+	leftMask    Uint128 // low 128-offset-size bits
+	rightMask   Uint128 // low offset bits
+	offsetShift int     // offset
+	leftShift   int     // offset + size
+	prefixShift int     // 128 - size, also how far up reversing leaves the field
+}
+
+const bits128 = 128
+
+// NewEncoder128 constructs an Encoder128 that will extract `size` bits
+// starting at bit `offset` (0 = LSB), reverse them, and prepend into the
+// top `size` bits.  The layout is not validated; call Validate when
+// offset and size are untrusted.
+func NewEncoder128(offset, size int) Encoder128 {
+	e := Encoder128{
+		offset:    offset,
+		size:      size,
+		hexDigits: (size + 3) / 4,
+	}
+	if e.Validate() != nil {
+		// leave the masks and shifts zero: Encode, Decode and Prefix of
+		// an invalid layout return zero rather than panicking on a
+		// negative shift
+		return e
+	}
+	e.fieldMask = Mask128(size)
+	e.leftMask = Mask128(bits128 - offset - size)
+	e.rightMask = Mask128(offset)
+	e.offsetShift = offset
+	e.leftShift = offset + size
+	e.prefixShift = bits128 - size
+	return e
+}
+
+// Validate reports whether the layout fits inside 128 bits.
+func (e Encoder128) Validate() error {
+	switch {
+	case e.offset < 0:
+		return fmt.Errorf("%w: offset=%d", ErrNegativeOffset, e.offset)
+	case e.size < 0:
+		return fmt.Errorf("%w: size=%d", ErrNegativeSize, e.size)
+	case e.offset+e.size > bits128:
+		return fmt.Errorf("%w: offset=%d size=%d width=%d", ErrLayoutOverflow, e.offset, e.size, bits128)
+	}
+	return nil
+}
+
+// LeftSize is the number of LSB bits right of the prefix.
+func (e Encoder128) LeftSize() int { return e.offset }
+
+// PrefixSize is the width in bits of the prefix.
+func (e Encoder128) PrefixSize() int { return e.size }
+
+// RightSize is the number of MSB bits left of the prefix.
+func (e Encoder128) RightSize() int { return bits128 - e.offset - e.size }
+
+// EncodedBits returns the number of bits in an encoded value.
+func (e Encoder128) EncodedBits() int { return bits128 }
+
+// PrefixHexSize returns the number of hex nibbles required to display the prefix.
+func (e Encoder128) PrefixHexSize() int { return e.hexDigits }
+
+// Encode embeds v by extracting [offset..offset+size) bits,
+// reversing them, and prepending into the top size bits.
+func (e Encoder128) Encode(v Uint128) Uint128 {
+	field := v.Rsh(e.offsetShift).And(e.fieldMask)
+	rev := e.reverse(field)
+	left := v.Rsh(e.leftShift).And(e.leftMask)
+	right := v.And(e.rightMask)
+	return rev.Lsh(e.prefixShift).Or(left.Lsh(e.offsetShift)).Or(right)
+}
+
+// Decode is the inverse of Encode.
+func (e Encoder128) Decode(u Uint128) Uint128 {
+	rev := u.Rsh(e.prefixShift).And(e.fieldMask)
+	field := e.reverse(rev)
+	left := u.Rsh(e.offsetShift).And(e.leftMask)
+	right := u.And(e.rightMask)
+	return left.Lsh(e.leftShift).Or(field.Lsh(e.offsetShift)).Or(right)
+}
+
+// Prefix extracts the top size bits of u (the reversed segment).
+func (e Encoder128) Prefix(u Uint128) Uint128 {
+	return u.Rsh(e.prefixShift).And(e.fieldMask)
+}
+
+// PrefixHexPad shifts prefix so its MSB lands at the MSB of the nibble block.
+func (e Encoder128) PrefixHexPad(prefix Uint128) Uint128 {
+	return prefix.Lsh(e.hexDigits*4 - e.size)
+}
+
+// reverse reverses the low size bits of x, which must have no other bits
+// set.  A shift of 128 yields zero, so a zero size needs no branch.
+func (e Encoder128) reverse(x Uint128) Uint128 {
+	return Uint128{Hi: bits.Reverse64(x.Lo), Lo: bits.Reverse64(x.Hi)}.Rsh(e.prefixShift)
+}
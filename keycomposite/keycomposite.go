@@ -0,0 +1,244 @@
+// Package keycomposite packs a tenant and a time-ordered ID into one
+// shard-encoded 64- or 128-bit key laid out as
+//
+//	[ prefix | tenant | ID without its shard segment ]
+//
+// The prefix is derived from the ID's reversed shard segment (as
+// key64.Encoder does), from a hash of the tenant, or from both XORed
+// together, so the tenant can influence placement.  Keys decode back into
+// both components.
+package keycomposite
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+	"github.com/sean-/go-sharded-cluster-keys/keybits"
+)
+
+// Mix selects how the shard prefix is derived.
+type Mix int
+
+const (
+	// MixTime uses the reversed shard segment of the ID, exactly like
+	// key64.NewEncoder(Offset, Size) on the ID alone.  Every tenant
+	// rotates through the shards together.
+	MixTime Mix = iota
+	// MixTenant uses the hashed tenant only, pinning each tenant to one
+	// shard.  The ID is stored unshuffled and Offset is ignored.
+	MixTenant
+	// MixXOR XORs the reversed ID segment with the hashed tenant, so
+	// tenants rotate through the shards out of step with each other.
+	MixXOR
+)
+
+func (m Mix) String() string {
+	switch m {
+	case MixTime:
+		return "time"
+	case MixTenant:
+		return "tenant"
+	case MixXOR:
+		return "xor"
+	}
+	return fmt.Sprintf("Mix(%d)", int(m))
+}
+
+// Layout describes a composite key.
+type Layout struct {
+	// TenantBits and IDBits are the widths of the two components.
+	TenantBits, IDBits int
+	// Offset and Size locate the shard segment within the ID, as for
+	// key64.NewEncoder.  Size is also the width of the prefix.
+	Offset, Size int
+	// Mix selects how the prefix is derived.
+	Mix Mix
+}
+
+// Errors returned by the constructors and Encode.
+var (
+	ErrLayout     = errors.New("keycomposite: invalid layout")
+	ErrFieldRange = errors.New("keycomposite: component does not fit in its field")
+)
+
+// codec holds what the 64- and 128-bit encoders share: everything except
+// the final packing.
+type codec struct {
+	l        Layout
+	restBits int                     // bits of the ID stored below the tenant
+	id       keybits.Encoder[uint64] // moves the ID's shard segment to its top
+}
+
+func newCodec(l Layout, width int) (codec, error) {
+	switch {
+	case l.TenantBits < 0 || l.TenantBits > 64:
+		return codec{}, fmt.Errorf("%w: TenantBits=%d outside [0,64]", ErrLayout, l.TenantBits)
+	case l.IDBits < 1 || l.IDBits > 64:
+		return codec{}, fmt.Errorf("%w: IDBits=%d outside [1,64]", ErrLayout, l.IDBits)
+	case l.Size < 0 || l.Size > 64:
+		return codec{}, fmt.Errorf("%w: Size=%d outside [0,64]", ErrLayout, l.Size)
+	case l.Mix < MixTime || l.Mix > MixXOR:
+		return codec{}, fmt.Errorf("%w: unknown %s", ErrLayout, l.Mix)
+	}
+
+	c := codec{l: l}
+	if l.Mix == MixTenant {
+		c.restBits = l.IDBits
+		c.id = keybits.NewEncoderWidth[uint64](l.IDBits, 0, 0)
+	} else {
+		c.restBits = l.IDBits - l.Size
+		c.id = keybits.NewEncoderWidth[uint64](l.IDBits, l.Offset, l.Size)
+		if err := c.id.Validate(); err != nil {
+			return codec{}, fmt.Errorf("%w: ID segment: %w", ErrLayout, err)
+		}
+	}
+	if total := l.Size + l.TenantBits + c.restBits; total > width {
+		return codec{}, fmt.Errorf("%w: needs %d bits, key has %d", ErrLayout, total, width)
+	}
+	return c, nil
+}
+
+// split checks the components and returns the prefix and the stored ID
+// bits.
+func (c codec) split(tenant, id uint64) (prefix, rest uint64, err error) {
+	if tenant&^mask(c.l.TenantBits) != 0 {
+		return 0, 0, fmt.Errorf("%w: tenant %#x needs more than %d bits", ErrFieldRange, tenant, c.l.TenantBits)
+	}
+	if id&^mask(c.l.IDBits) != 0 {
+		return 0, 0, fmt.Errorf("%w: ID %#x needs more than %d bits", ErrFieldRange, id, c.l.IDBits)
+	}
+
+	shuffled := c.id.Encode(id)
+	rest = shuffled & mask(c.restBits)
+	switch c.l.Mix {
+	case MixTime:
+		prefix = shuffled >> c.restBits
+	case MixTenant:
+		prefix = c.tenantPrefix(tenant)
+	case MixXOR:
+		prefix = shuffled>>c.restBits ^ c.tenantPrefix(tenant)
+	}
+	return prefix, rest, nil
+}
+
+// join inverts split.
+func (c codec) join(prefix, tenant, rest uint64) (id uint64) {
+	if c.l.Mix == MixTenant {
+		return rest
+	}
+	segment := prefix
+	if c.l.Mix == MixXOR {
+		segment ^= c.tenantPrefix(tenant)
+	}
+	return c.id.Decode(segment<<c.restBits | rest)
+}
+
+// tenantPrefix hashes tenant down to a Size-bit prefix.
+func (c codec) tenantPrefix(tenant uint64) uint64 {
+	return TenantHash(tenant) >> (64 - c.l.Size)
+}
+
+// TenantHash is the hash the MixTenant and MixXOR prefixes take their top
+// Size bits from: the splitmix64 finalizer, a bijection on uint64 that
+// spreads sequential tenant numbers evenly.
+func TenantHash(tenant uint64) uint64 {
+	z := tenant + 0x9e3779b97f4a7c15
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return z ^ z>>31
+}
+
+// mask returns a uint64 with the low n bits set; n may be 64.
+func mask(n int) uint64 {
+	return 1<<n - 1
+}
+
+// Encoder64 packs composite keys into a key64.Value.
+type Encoder64 struct {
+	c codec
+}
+
+// NewEncoder64 returns an Encoder64 for l.  The prefix, tenant and stored
+// ID bits must fit in 64 bits.
+func NewEncoder64(l Layout) (*Encoder64, error) {
+	c, err := newCodec(l, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &Encoder64{c: c}, nil
+}
+
+// Layout returns the layout e was built with.
+func (e *Encoder64) Layout() Layout { return e.c.l }
+
+// PrefixSize returns the width in bits of the shard prefix.
+func (e *Encoder64) PrefixSize() int { return e.c.l.Size }
+
+// Encode packs tenant and id.  It returns ErrFieldRange if either does not
+// fit in its field.
+func (e *Encoder64) Encode(tenant, id uint64) (key64.Value, error) {
+	prefix, rest, err := e.c.split(tenant, id)
+	if err != nil {
+		return 0, err
+	}
+	// a shift of 64 leaves zero, so a zero Size needs no branch
+	return key64.Value(prefix<<(64-e.c.l.Size) | tenant<<e.c.restBits | rest), nil
+}
+
+// Decode returns the tenant and ID packed into v.
+func (e *Encoder64) Decode(v key64.Value) (tenant, id uint64) {
+	w := uint64(v)
+	tenant = w >> e.c.restBits & mask(e.c.l.TenantBits)
+	return tenant, e.c.join(e.Prefix(v), tenant, w&mask(e.c.restBits))
+}
+
+// Prefix returns the shard prefix of v.
+func (e *Encoder64) Prefix(v key64.Value) uint64 {
+	return uint64(v) >> (64 - e.c.l.Size)
+}
+
+// Encoder128 packs composite keys into a keybits.Uint128, for 64-bit
+// tenants beside 64-bit IDs.
+type Encoder128 struct {
+	c codec
+}
+
+// NewEncoder128 returns an Encoder128 for l.  The prefix, tenant and
+// stored ID bits must fit in 128 bits.
+func NewEncoder128(l Layout) (*Encoder128, error) {
+	c, err := newCodec(l, 128)
+	if err != nil {
+		return nil, err
+	}
+	return &Encoder128{c: c}, nil
+}
+
+// Layout returns the layout e was built with.
+func (e *Encoder128) Layout() Layout { return e.c.l }
+
+// PrefixSize returns the width in bits of the shard prefix.
+func (e *Encoder128) PrefixSize() int { return e.c.l.Size }
+
+// Encode packs tenant and id.  It returns ErrFieldRange if either does not
+// fit in its field.
+func (e *Encoder128) Encode(tenant, id uint64) (keybits.Uint128, error) {
+	prefix, rest, err := e.c.split(tenant, id)
+	if err != nil {
+		return keybits.Uint128{}, err
+	}
+	return keybits.Uint128From(prefix).Lsh(128 - e.c.l.Size).
+		Or(keybits.Uint128From(tenant).Lsh(e.c.restBits)).
+		Or(keybits.Uint128From(rest)), nil
+}
+
+// Decode returns the tenant and ID packed into v.
+func (e *Encoder128) Decode(v keybits.Uint128) (tenant, id uint64) {
+	tenant = v.Rsh(e.c.restBits).Lo & mask(e.c.l.TenantBits)
+	return tenant, e.c.join(e.Prefix(v), tenant, v.Lo&mask(e.c.restBits))
+}
+
+// Prefix returns the shard prefix of v.
+func (e *Encoder128) Prefix(v keybits.Uint128) uint64 {
+	return v.Rsh(128 - e.c.l.Size).Lo
+}
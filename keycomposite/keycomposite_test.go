@@ -0,0 +1,131 @@
+package keycomposite
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+	"github.com/sean-/go-sharded-cluster-keys/keybits"
+)
+
+func TestMixTimeMatchesKey64(t *testing.T) {
+	e, err := NewEncoder64(Layout{IDBits: 64, Offset: 11, Size: 13})
+	require.NoError(t, err)
+	k := key64.NewEncoder(11, 13)
+
+	for _, id := range []uint64{0, 1, 0x0123456789ABCDEF, ^uint64(0)} {
+		v, err := e.Encode(0, id)
+		require.NoError(t, err)
+		require.Equal(t, k.Encode(id), v)
+		require.Equal(t, k.Prefix(v), e.Prefix(v))
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, mix := range []Mix{MixTime, MixTenant, MixXOR} {
+		l64 := Layout{TenantBits: 16, IDBits: 44, Offset: 11, Size: 4, Mix: mix}
+		e64, err := NewEncoder64(l64)
+		require.NoError(t, err, mix)
+		require.Equal(t, l64, e64.Layout())
+		require.Equal(t, 4, e64.PrefixSize())
+
+		l128 := Layout{TenantBits: 64, IDBits: 48, Offset: 11, Size: 16, Mix: mix}
+		e128, err := NewEncoder128(l128)
+		require.NoError(t, err, mix)
+		require.Equal(t, l128, e128.Layout())
+		require.Equal(t, 16, e128.PrefixSize())
+
+		for i := 0; i < 1000; i++ {
+			tenant, id := rng.Uint64(), rng.Uint64()
+
+			v, err := e64.Encode(tenant&0xffff, id&(1<<44-1))
+			require.NoError(t, err)
+			gotT, gotID := e64.Decode(v)
+			require.Equal(t, tenant&0xffff, gotT, mix)
+			require.Equal(t, id&(1<<44-1), gotID, mix)
+
+			w, err := e128.Encode(tenant, id&(1<<48-1))
+			require.NoError(t, err)
+			gotT, gotID = e128.Decode(w)
+			require.Equal(t, tenant, gotT, mix)
+			require.Equal(t, id&(1<<48-1), gotID, mix)
+			require.Less(t, e128.Prefix(w), uint64(1<<16))
+		}
+	}
+}
+
+func TestPrefixMix(t *testing.T) {
+	const offset, size = 11, 4
+	timeEnc, err := NewEncoder64(Layout{TenantBits: 16, IDBits: 48, Offset: offset, Size: size, Mix: MixTime})
+	require.NoError(t, err)
+	tenantEnc, err := NewEncoder64(Layout{TenantBits: 16, IDBits: 44, Offset: offset, Size: size, Mix: MixTenant})
+	require.NoError(t, err)
+	xorEnc, err := NewEncoder64(Layout{TenantBits: 16, IDBits: 48, Offset: offset, Size: size, Mix: MixXOR})
+	require.NoError(t, err)
+
+	seen := map[uint64]bool{}
+	for tenant := uint64(0); tenant < 256; tenant++ {
+		h := TenantHash(tenant) >> (64 - size)
+		for _, id := range []uint64{0, 1 << offset, 0x0123456789AB} {
+			tv, _ := timeEnc.Encode(tenant, id)
+			nv, _ := tenantEnc.Encode(tenant, id)
+			xv, _ := xorEnc.Encode(tenant, id)
+
+			// time: independent of the tenant
+			want := key64.NewEncoder(offset, size).Prefix(key64.NewEncoder(offset, size).Encode(id))
+			require.Equal(t, want, timeEnc.Prefix(tv))
+			// tenant: independent of the ID
+			require.Equal(t, h, tenantEnc.Prefix(nv))
+			// xor: both
+			require.Equal(t, want^h, xorEnc.Prefix(xv))
+		}
+		seen[h] = true
+	}
+	require.Len(t, seen, 1<<size, "256 tenants should reach every prefix")
+}
+
+func TestTenantHashBijective(t *testing.T) {
+	seen := map[uint64]bool{}
+	for i := uint64(0); i < 1<<16; i++ {
+		h := TenantHash(i)
+		require.False(t, seen[h])
+		seen[h] = true
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for name, l := range map[string]Layout{
+		"tenant bits":    {TenantBits: 65, IDBits: 1},
+		"id bits":        {IDBits: 0},
+		"size":           {IDBits: 64, Size: 65},
+		"mix":            {IDBits: 8, Mix: Mix(7)},
+		"segment":        {IDBits: 8, Offset: 6, Size: 4},
+		"too wide":       {TenantBits: 16, IDBits: 64},
+		"tenant too big": {TenantBits: 16, IDBits: 48, Size: 4, Mix: MixTenant},
+	} {
+		_, err := NewEncoder64(l)
+		require.ErrorIs(t, err, ErrLayout, name)
+	}
+	_, err := NewEncoder128(Layout{TenantBits: 64, IDBits: 64, Size: 1, Mix: MixTenant})
+	require.ErrorIs(t, err, ErrLayout)
+
+	e, err := NewEncoder64(Layout{TenantBits: 8, IDBits: 56, Offset: 4, Size: 4})
+	require.NoError(t, err)
+	_, err = e.Encode(256, 0)
+	require.ErrorIs(t, err, ErrFieldRange)
+	_, err = e.Encode(0, 1<<56)
+	require.ErrorIs(t, err, ErrFieldRange)
+
+	e128, err := NewEncoder128(Layout{TenantBits: 64, IDBits: 64, Size: 0})
+	require.NoError(t, err)
+	v, err := e128.Encode(^uint64(0), 7)
+	require.NoError(t, err)
+	require.Equal(t, keybits.Uint128{Hi: ^uint64(0), Lo: 7}, v)
+	require.Zero(t, e128.Prefix(v))
+
+	require.Equal(t, "xor", MixXOR.String())
+	require.Equal(t, "Mix(7)", Mix(7).String())
+}
@@ -0,0 +1,195 @@
+// Package keyperm generalises the key32/key64 transform to several fields:
+// an ordered list of bit fields, each optionally reversed, is stacked from
+// the most significant bit down to form the shard prefix, and every
+// remaining bit is packed below it in its original order.  The result is a
+// bijection over uint64 or UUID values.
+//
+// key64.NewEncoder(offset, size) is the single field
+// Field{Offset: offset, Size: size, Reverse: true}.
+package keyperm
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+	"github.com/sean-/go-sharded-cluster-keys/keybits"
+)
+
+// Field selects Size bits starting at bit Offset (0 = LSB) of the original
+// value.  Reverse flips their order on the way into the prefix.
+type Field struct {
+	Offset, Size int
+	Reverse      bool
+}
+
+// Errors returned by the constructors.
+var (
+	ErrField   = errors.New("keyperm: field outside the word")
+	ErrOverlap = errors.New("keyperm: fields overlap")
+)
+
+// run is a contiguous span of original bits.
+type run struct {
+	offset, size int
+}
+
+// perm is the width-independent core: Encoder64 runs it over the low half
+// of a Uint128.
+type perm struct {
+	width      int
+	fields     []Field
+	rest       []run // bits outside every field, ascending
+	prefixSize int
+}
+
+func newPerm(width int, fields []Field) (perm, error) {
+	p := perm{width: width, fields: append([]Field(nil), fields...)}
+
+	spans := make([]run, 0, len(fields))
+	for i, f := range fields {
+		if f.Offset < 0 || f.Size < 0 || f.Offset+f.Size > width {
+			return perm{}, fmt.Errorf("%w: field %d {offset=%d size=%d} in a %d-bit word", ErrField, i, f.Offset, f.Size, width)
+		}
+		if f.Size > 0 {
+			spans = append(spans, run{f.Offset, f.Size})
+		}
+		p.prefixSize += f.Size
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].offset < spans[j].offset })
+
+	next := 0
+	for _, s := range spans {
+		if s.offset < next {
+			return perm{}, fmt.Errorf("%w: bit %d is selected twice", ErrOverlap, s.offset)
+		}
+		if s.offset > next {
+			p.rest = append(p.rest, run{next, s.offset - next})
+		}
+		next = s.offset + s.size
+	}
+	if next < width {
+		p.rest = append(p.rest, run{next, width - next})
+	}
+	return p, nil
+}
+
+func (p perm) encode(v keybits.Uint128) keybits.Uint128 {
+	var out keybits.Uint128
+	pos := p.width
+	for _, f := range p.fields {
+		seg := v.Rsh(f.Offset).And(keybits.Mask128(f.Size))
+		if f.Reverse {
+			seg = keybits.Reverse128(seg, f.Size)
+		}
+		pos -= f.Size
+		out = out.Or(seg.Lsh(pos))
+	}
+	pos = 0
+	for _, r := range p.rest {
+		out = out.Or(v.Rsh(r.offset).And(keybits.Mask128(r.size)).Lsh(pos))
+		pos += r.size
+	}
+	return out
+}
+
+func (p perm) decode(e keybits.Uint128) keybits.Uint128 {
+	var out keybits.Uint128
+	pos := p.width
+	for _, f := range p.fields {
+		pos -= f.Size
+		seg := e.Rsh(pos).And(keybits.Mask128(f.Size))
+		if f.Reverse {
+			seg = keybits.Reverse128(seg, f.Size)
+		}
+		out = out.Or(seg.Lsh(f.Offset))
+	}
+	pos = 0
+	for _, r := range p.rest {
+		out = out.Or(e.Rsh(pos).And(keybits.Mask128(r.size)).Lsh(r.offset))
+		pos += r.size
+	}
+	return out
+}
+
+func (p perm) prefix(e keybits.Uint128) keybits.Uint128 {
+	return e.Rsh(p.width - p.prefixSize)
+}
+
+// Encoder64 permutes the bits of uint64 values.
+type Encoder64 struct {
+	p perm
+}
+
+// New64 returns an Encoder64 stacking fields from the MSB down in the
+// order given.  Fields must not overlap; zero-size fields are ignored.
+func New64(fields ...Field) (*Encoder64, error) {
+	p, err := newPerm(64, fields)
+	if err != nil {
+		return nil, err
+	}
+	return &Encoder64{p: p}, nil
+}
+
+// Fields returns the fields e was built with.
+func (e *Encoder64) Fields() []Field { return append([]Field(nil), e.p.fields...) }
+
+// PrefixSize returns the total size of the fields.
+func (e *Encoder64) PrefixSize() int { return e.p.prefixSize }
+
+// Encode permutes v.
+func (e *Encoder64) Encode(v uint64) key64.Value {
+	return key64.Value(e.p.encode(keybits.Uint128From(v)).Lo)
+}
+
+// Decode is the inverse of Encode.
+func (e *Encoder64) Decode(v key64.Value) uint64 {
+	return e.p.decode(keybits.Uint128From(uint64(v))).Lo
+}
+
+// Prefix returns the top PrefixSize bits of v.
+func (e *Encoder64) Prefix(v key64.Value) uint64 {
+	return e.p.prefix(keybits.Uint128From(uint64(v))).Lo
+}
+
+// EncoderUUID permutes the bits of UUIDs read as 128-bit big-endian
+// integers: bit 0 is the least significant bit of byte 15, bit 127 the
+// most significant bit of byte 0.
+type EncoderUUID struct {
+	p perm
+}
+
+// NewUUID returns an EncoderUUID stacking fields from the MSB down in the
+// order given.  keyuuid.NewEncoder(totalBits, offset, size) is the single
+// field {Offset: 128-totalBits+offset, Size: size, Reverse: true}.
+func NewUUID(fields ...Field) (*EncoderUUID, error) {
+	p, err := newPerm(128, fields)
+	if err != nil {
+		return nil, err
+	}
+	return &EncoderUUID{p: p}, nil
+}
+
+// Fields returns the fields e was built with.
+func (e *EncoderUUID) Fields() []Field { return append([]Field(nil), e.p.fields...) }
+
+// PrefixSize returns the total size of the fields.
+func (e *EncoderUUID) PrefixSize() int { return e.p.prefixSize }
+
+// Encode permutes u.
+func (e *EncoderUUID) Encode(u uuid.UUID) uuid.UUID {
+	return e.p.encode(keybits.Uint128FromBytes(u)).Bytes()
+}
+
+// Decode is the inverse of Encode.
+func (e *EncoderUUID) Decode(u uuid.UUID) uuid.UUID {
+	return e.p.decode(keybits.Uint128FromBytes(u)).Bytes()
+}
+
+// Prefix returns the top PrefixSize bits of u as an integer.
+func (e *EncoderUUID) Prefix(u uuid.UUID) keybits.Uint128 {
+	return e.p.prefix(keybits.Uint128FromBytes(u))
+}
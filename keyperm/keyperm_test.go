@@ -0,0 +1,119 @@
+package keyperm
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+	"github.com/sean-/go-sharded-cluster-keys/keyuuid"
+)
+
+func TestSingleFieldMatchesKey64(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, l := range []struct{ offset, size int }{{0, 0}, {0, 64}, {11, 13}, {60, 4}, {0, 1}, {32, 16}} {
+		e, err := New64(Field{Offset: l.offset, Size: l.size, Reverse: true})
+		require.NoError(t, err)
+		k := key64.NewEncoder(l.offset, l.size)
+		require.Equal(t, l.size, e.PrefixSize())
+
+		for i := 0; i < 1000; i++ {
+			v := rng.Uint64()
+			enc := e.Encode(v)
+			require.Equalf(t, k.Encode(v), enc, "offset=%d size=%d v=%#x", l.offset, l.size, v)
+			require.Equal(t, k.Prefix(enc), e.Prefix(enc))
+			require.Equal(t, v, e.Decode(enc))
+		}
+	}
+}
+
+func TestSingleFieldMatchesKeyUUID(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	for _, l := range []struct{ total, offset, size int }{{48, 11, 4}, {48, 16, 16}, {64, 0, 64}, {1, 0, 1}} {
+		e, err := NewUUID(Field{Offset: 128 - l.total + l.offset, Size: l.size, Reverse: true})
+		require.NoError(t, err)
+		k := keyuuid.MustNewEncoder(l.total, l.offset, l.size)
+
+		for i := 0; i < 1000; i++ {
+			var u uuid.UUID
+			for j := range u {
+				u[j] = byte(rng.Uint32())
+			}
+			enc := e.Encode(u)
+			require.Equalf(t, k.Encode(u), enc, "%+v %s", l, u)
+			require.Equal(t, k.PrefixBits(enc), e.Prefix(enc).Lo)
+			require.Equal(t, u, e.Decode(enc))
+		}
+	}
+}
+
+func TestMultiField(t *testing.T) {
+	// A snowflake-style key: 41-bit timestamp at bit 22, 10-bit worker at
+	// bit 12.  Take 4 reversed timestamp bits from bit 33, then 3 worker
+	// bits from bit 12, in order.
+	e, err := New64(
+		Field{Offset: 33, Size: 4, Reverse: true},
+		Field{Offset: 12, Size: 3},
+	)
+	require.NoError(t, err)
+	require.Equal(t, 7, e.PrefixSize())
+	require.Equal(t, []Field{{33, 4, true}, {12, 3, false}}, e.Fields())
+
+	v := uint64(0b0001)<<33 | uint64(0b101)<<12 | 0xabc
+	enc := e.Encode(v)
+	require.Equal(t, uint64(0b1000_101), e.Prefix(enc))
+	require.Equal(t, uint64(0xabc), uint64(enc)&0xfff, "bits below every field stay in place")
+	require.Equal(t, v, e.Decode(enc))
+
+	rng := rand.New(rand.NewPCG(5, 6))
+	for i := 0; i < 1000; i++ {
+		v := rng.Uint64()
+		require.Equal(t, v, e.Decode(e.Encode(v)))
+	}
+}
+
+func TestBijection(t *testing.T) {
+	// Every 8-bit input must map to a distinct output when only the low
+	// byte is in play.
+	e, err := New64(Field{Offset: 2, Size: 3, Reverse: true}, Field{Offset: 6, Size: 2}, Field{Offset: 0, Size: 1, Reverse: true})
+	require.NoError(t, err)
+	seen := map[key64.Value]bool{}
+	for v := uint64(0); v < 256; v++ {
+		enc := e.Encode(v)
+		require.False(t, seen[enc], v)
+		seen[enc] = true
+		require.Equal(t, v, e.Decode(enc))
+	}
+}
+
+func TestUUIDMultiField(t *testing.T) {
+	// UUIDv7: reverse 4 timestamp bits, then take 4 bits of rand_a.
+	e, err := NewUUID(Field{Offset: 80 + 11, Size: 4, Reverse: true}, Field{Offset: 64, Size: 4})
+	require.NoError(t, err)
+	require.Equal(t, 8, e.PrefixSize())
+
+	u := uuid.MustParse("018f14e0-8f0a-7def-91b4-f0ecb69f5f01")
+	enc := e.Encode(u)
+	require.Equal(t, uint64(0x8f), e.Prefix(enc).Lo)
+	require.Equal(t, u, e.Decode(enc))
+}
+
+func TestErrors(t *testing.T) {
+	for name, fields := range map[string][]Field{
+		"negative-offset": {{Offset: -1, Size: 1}},
+		"negative-size":   {{Offset: 0, Size: -1}},
+		"past-the-end":    {{Offset: 60, Size: 5}},
+	} {
+		_, err := New64(fields...)
+		require.ErrorIs(t, err, ErrField, name)
+	}
+
+	_, err := New64(Field{Offset: 8, Size: 8}, Field{Offset: 15, Size: 2})
+	require.ErrorIs(t, err, ErrOverlap)
+	_, err = NewUUID(Field{Offset: 100, Size: 8}, Field{Offset: 100, Size: 1})
+	require.ErrorIs(t, err, ErrOverlap)
+	_, err = NewUUID(Field{Offset: 64, Size: 64}, Field{Offset: 0, Size: 64})
+	require.NoError(t, err)
+}
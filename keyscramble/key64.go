@@ -0,0 +1,67 @@
+package keyscramble
+
+import (
+	"fmt"
+
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+)
+
+// Scrambler64 shard-encodes uint64 keys with a key64.Encoder and then
+// scrambles the 64-PrefixSize bits below the prefix.
+type Scrambler64 struct {
+	enc key64.Encoder
+	f   feistel
+}
+
+// New64 returns a Scrambler64 for enc keyed by secret, which must be a
+// 16, 24 or 32-byte AES key.
+func New64(enc key64.Encoder, secret []byte) (*Scrambler64, error) {
+	f, err := newFeistel(secret, 64-enc.PrefixSize(), 64, enc.PrefixSize())
+	if err != nil {
+		return nil, err
+	}
+	return &Scrambler64{enc: enc, f: f}, nil
+}
+
+// Encoder returns the underlying key64 encoder.
+func (s *Scrambler64) Encoder() key64.Encoder { return s.enc }
+
+// Encode shard-encodes v and scrambles the result.
+func (s *Scrambler64) Encode(v uint64) key64.Value { return s.Scramble(s.enc.Encode(v)) }
+
+// Decode is the inverse of Encode.
+func (s *Scrambler64) Decode(v key64.Value) uint64 { return s.enc.Decode(s.Unscramble(v)) }
+
+// Prefix returns the shard prefix of v, which scrambling leaves as-is.
+func (s *Scrambler64) Prefix(v key64.Value) uint64 { return s.enc.Prefix(v) }
+
+// Scramble scrambles the bits below the prefix of an encoded key.
+func (s *Scrambler64) Scramble(v key64.Value) key64.Value {
+	a, b := s.f.encrypt(s.split(v))
+	return s.join(v, a, b)
+}
+
+// Unscramble is the inverse of Scramble.
+func (s *Scrambler64) Unscramble(v key64.Value) key64.Value {
+	a, b := s.f.decrypt(s.split(v))
+	return s.join(v, a, b)
+}
+
+// Rekey rewrites a key scrambled by s as if next had scrambled it.  The
+// prefix is unchanged.  Both scramblers must share a layout.
+func (s *Scrambler64) Rekey(v key64.Value, next *Scrambler64) (key64.Value, error) {
+	if s.enc.LeftSize() != next.enc.LeftSize() || s.enc.PrefixSize() != next.enc.PrefixSize() {
+		return 0, fmt.Errorf("%w: offset=%d size=%d and offset=%d size=%d", ErrLayoutMismatch,
+			s.enc.LeftSize(), s.enc.PrefixSize(), next.enc.LeftSize(), next.enc.PrefixSize())
+	}
+	return next.Scramble(s.Unscramble(v)), nil
+}
+
+func (s *Scrambler64) split(v key64.Value) (a, b uint64) {
+	return uint64(v) >> s.f.bBits & s.f.aMask, uint64(v) & s.f.bMask
+}
+
+func (s *Scrambler64) join(v key64.Value, a, b uint64) key64.Value {
+	n := s.f.aBits + s.f.bBits
+	return key64.Value(uint64(v)&^mask(n) | a<<s.f.bBits | b)
+}
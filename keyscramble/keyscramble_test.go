@@ -0,0 +1,157 @@
+package keyscramble
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+	"github.com/sean-/go-sharded-cluster-keys/keyuuid"
+)
+
+var (
+	secretA = bytes.Repeat([]byte{0xa5}, 16)
+	secretB = bytes.Repeat([]byte{0x5a}, 32)
+)
+
+func TestRoundTrip64(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, l := range []struct{ offset, size int }{{0, 0}, {11, 13}, {0, 63}, {0, 64}, {32, 7}} {
+		enc := key64.NewEncoder(l.offset, l.size)
+		s, err := New64(enc, secretA)
+		require.NoError(t, err)
+		require.Equal(t, enc, s.Encoder())
+
+		for i := 0; i < 1000; i++ {
+			v := rng.Uint64()
+			got := s.Encode(v)
+			require.Equal(t, enc.Prefix(enc.Encode(v)), s.Prefix(got), "prefix must survive")
+			require.Equal(t, v, s.Decode(got))
+		}
+	}
+}
+
+func TestOpaque64(t *testing.T) {
+	enc := key64.NewEncoder(11, 13)
+	s, err := New64(enc, secretA)
+	require.NoError(t, err)
+
+	// Consecutive IDs land in the same shard but no longer sort in order
+	// or share their low bits.
+	var ascending int
+	prev := s.Encode(1 << 40)
+	for v := uint64(1<<40 + 1); v < 1<<40+1000; v++ {
+		got := s.Encode(v)
+		require.Equal(t, s.Prefix(prev), s.Prefix(got))
+		if got > prev {
+			ascending++
+		}
+		prev = got
+	}
+	require.InDelta(t, 500, ascending, 100)
+
+	other, err := New64(enc, secretB)
+	require.NoError(t, err)
+	v := uint64(0x0123456789abcdef)
+	require.NotEqual(t, s.Encode(v), other.Encode(v))
+	require.NotEqual(t, v, other.Decode(s.Encode(v)), "decoding needs the secret")
+}
+
+func TestBijection64(t *testing.T) {
+	// With a 56-bit prefix only 8 bits are scrambled: every value must be
+	// hit exactly once, odd halves included.
+	for _, size := range []int{56, 57} {
+		s, err := New64(key64.NewEncoder(0, size), secretA)
+		require.NoError(t, err)
+		seen := map[key64.Value]bool{}
+		for v := key64.Value(0); v < 1<<(64-size); v++ {
+			got := s.Scramble(v)
+			require.Less(t, got, key64.Value(1<<(64-size)))
+			require.False(t, seen[got], v)
+			seen[got] = true
+			require.Equal(t, v, s.Unscramble(got))
+		}
+	}
+}
+
+func TestRekey64(t *testing.T) {
+	enc := key64.NewEncoder(11, 13)
+	oldS, err := New64(enc, secretA)
+	require.NoError(t, err)
+	newS, err := New64(enc, secretB)
+	require.NoError(t, err)
+
+	v := uint64(0x0123456789abcdef)
+	got, err := oldS.Rekey(oldS.Encode(v), newS)
+	require.NoError(t, err)
+	require.Equal(t, newS.Encode(v), got)
+	require.Equal(t, oldS.Prefix(oldS.Encode(v)), newS.Prefix(got))
+
+	other, err := New64(key64.NewEncoder(11, 12), secretB)
+	require.NoError(t, err)
+	_, err = oldS.Rekey(got, other)
+	require.ErrorIs(t, err, ErrLayoutMismatch)
+}
+
+func TestUUID(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	for _, enc := range []keyuuid.Encoder{keyuuid.NewUUIDv7Encoder(), keyuuid.NewULIDEncoder(), keyuuid.NewEncoder(0, 0, 0), keyuuid.NewEncoder(64, 0, 64)} {
+		s, err := NewUUID(enc, secretA)
+		require.NoError(t, err)
+		require.Equal(t, enc, s.Encoder())
+
+		for i := 0; i < 1000; i++ {
+			var u uuid.UUID
+			for j := range u {
+				u[j] = byte(rng.Uint32())
+			}
+			u[6] = u[6]&0x0f | 0x70
+			u[8] = u[8]&0x3f | 0x80
+
+			got := s.Encode(u)
+			require.Equal(t, enc.PrefixBits(enc.Encode(u)), s.PrefixBits(got))
+			require.Equal(t, u, s.Decode(got))
+			if enc.PrefixSize() <= 48 {
+				require.Equal(t, uuid.Version(7), got.Version())
+				require.Equal(t, uuid.RFC4122, got.Variant())
+			}
+		}
+	}
+
+	u := uuid.MustParse("018f14e0-8f0a-7def-91b4-f0ecb69f5f01")
+	s, err := NewUUID(keyuuid.NewUUIDv7Encoder(), secretA)
+	require.NoError(t, err)
+	plain := keyuuid.NewUUIDv7Encoder().Encode(u)
+	require.NotEqual(t, plain, s.Encode(u))
+
+	next, err := NewUUID(keyuuid.NewUUIDv7Encoder(), secretB)
+	require.NoError(t, err)
+	got, err := s.Rekey(s.Encode(u), next)
+	require.NoError(t, err)
+	require.Equal(t, next.Encode(u), got)
+
+	ulid, err := NewUUID(keyuuid.NewULIDEncoder(), secretB)
+	require.NoError(t, err)
+	_, err = s.Rekey(got, ulid)
+	require.ErrorIs(t, err, ErrLayoutMismatch)
+}
+
+func TestKeySize(t *testing.T) {
+	_, err := New64(key64.NewEncoder(11, 13), []byte("short"))
+	require.ErrorIs(t, err, ErrKeySize)
+	_, err = NewUUID(keyuuid.NewUUIDv7Encoder(), make([]byte, 20))
+	require.ErrorIs(t, err, ErrKeySize)
+}
+
+var sink key64.Value
+
+func BenchmarkEncode64(b *testing.B) {
+	s, err := New64(key64.NewEncoder(11, 13), secretA)
+	require.NoError(b, err)
+	for i := 0; i < b.N; i++ {
+		sink = s.Encode(uint64(i))
+	}
+}
@@ -0,0 +1,118 @@
+package keyscramble
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/sean-/go-sharded-cluster-keys/keybits"
+	"github.com/sean-/go-sharded-cluster-keys/keyuuid"
+)
+
+// Bit positions, counted from the LSB of byte 15, of the RFC 9562 fields
+// ScramblerUUID leaves in place so scrambled keys still parse as the same
+// UUID version and variant.
+const (
+	variantOffset, variantBits = 62, 2
+	versionOffset, versionBits = 76, 4
+)
+
+// run is a contiguous span of scrambled bits.
+type run struct {
+	offset, size int
+}
+
+// ScramblerUUID shard-encodes UUIDs with a keyuuid.Encoder and then
+// scrambles every bit below the prefix except the version and variant.
+type ScramblerUUID struct {
+	enc  keyuuid.Encoder
+	f    feistel
+	runs []run // scrambled bits, ascending
+}
+
+// NewUUID returns a ScramblerUUID for enc keyed by secret, which must be a
+// 16, 24 or 32-byte AES key.  The version and variant are kept only where
+// they fall below the prefix.
+func NewUUID(enc keyuuid.Encoder, secret []byte) (*ScramblerUUID, error) {
+	free := 128 - enc.PrefixSize()
+	var runs []run
+	next, n := 0, 0
+	for _, keep := range []run{{variantOffset, variantBits}, {versionOffset, versionBits}} {
+		end := min(keep.offset, free)
+		if end > next {
+			runs = append(runs, run{next, end - next})
+			n += end - next
+		}
+		next = keep.offset + keep.size
+	}
+	if free > next {
+		runs = append(runs, run{next, free - next})
+		n += free - next
+	}
+
+	f, err := newFeistel(secret, n, 128, enc.PrefixSize())
+	if err != nil {
+		return nil, err
+	}
+	return &ScramblerUUID{enc: enc, f: f, runs: runs}, nil
+}
+
+// Encoder returns the underlying keyuuid encoder.
+func (s *ScramblerUUID) Encoder() keyuuid.Encoder { return s.enc }
+
+// Encode shard-encodes u and scrambles the result.
+func (s *ScramblerUUID) Encode(u uuid.UUID) keyuuid.Value { return s.Scramble(s.enc.Encode(u)) }
+
+// Decode is the inverse of Encode.
+func (s *ScramblerUUID) Decode(v keyuuid.Value) uuid.UUID { return s.enc.Decode(s.Unscramble(v)) }
+
+// PrefixBits returns the shard prefix of v, which scrambling leaves as-is.
+func (s *ScramblerUUID) PrefixBits(v keyuuid.Value) uint64 { return s.enc.PrefixBits(v) }
+
+// Scramble scrambles the bits below the prefix of an encoded key.
+func (s *ScramblerUUID) Scramble(v keyuuid.Value) keyuuid.Value {
+	a, b := s.f.encrypt(s.split(v))
+	return s.join(v, a, b)
+}
+
+// Unscramble is the inverse of Scramble.
+func (s *ScramblerUUID) Unscramble(v keyuuid.Value) keyuuid.Value {
+	a, b := s.f.decrypt(s.split(v))
+	return s.join(v, a, b)
+}
+
+// Rekey rewrites a key scrambled by s as if next had scrambled it.  The
+// prefix is unchanged.  Both scramblers must share a layout.
+func (s *ScramblerUUID) Rekey(v keyuuid.Value, next *ScramblerUUID) (keyuuid.Value, error) {
+	if s.enc.LeftSize() != next.enc.LeftSize() || s.enc.PrefixSize() != next.enc.PrefixSize() ||
+		s.enc.RightSize() != next.enc.RightSize() {
+		return keyuuid.Value{}, fmt.Errorf("%w: prefix sizes %d and %d", ErrLayoutMismatch,
+			s.enc.PrefixSize(), next.enc.PrefixSize())
+	}
+	return next.Scramble(s.Unscramble(v)), nil
+}
+
+// split gathers the scrambled bits of v and cuts them into Feistel halves.
+func (s *ScramblerUUID) split(v keyuuid.Value) (a, b uint64) {
+	w := keybits.Uint128FromBytes(v)
+	var packed keybits.Uint128
+	pos := 0
+	for _, r := range s.runs {
+		packed = packed.Or(w.Rsh(r.offset).And(keybits.Mask128(r.size)).Lsh(pos))
+		pos += r.size
+	}
+	return packed.Rsh(s.f.bBits).Lo & s.f.aMask, packed.Lo & s.f.bMask
+}
+
+// join scatters the halves back over the scrambled bits of v.
+func (s *ScramblerUUID) join(v keyuuid.Value, a, b uint64) keyuuid.Value {
+	w := keybits.Uint128FromBytes(v)
+	packed := keybits.Uint128From(a).Lsh(s.f.bBits).Or(keybits.Uint128From(b))
+	pos := 0
+	for _, r := range s.runs {
+		m := keybits.Mask128(r.size).Lsh(r.offset)
+		w = w.And(keybits.Uint128{Hi: ^m.Hi, Lo: ^m.Lo}).Or(packed.Rsh(pos).And(keybits.Mask128(r.size)).Lsh(r.offset))
+		pos += r.size
+	}
+	return w.Bytes()
+}
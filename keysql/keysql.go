@@ -0,0 +1,135 @@
+// Package keysql defines the database/sql column formats shared by the
+// key32, key64 and keyuuid Value types, and the conversions behind their
+// driver.Valuer and sql.Scanner implementations.
+package keysql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Format selects how an encoded key is represented in a column.
+type Format int
+
+const (
+	// Int64 stores the key's bits in a signed BIGINT.  64-bit keys with the
+	// top bit set become negative (two's complement); narrower keys are
+	// stored as their non-negative value.
+	Int64 Format = iota
+	// Bytes stores the key as fixed-width big-endian bytes (BYTEA, BLOB,
+	// BINARY(n)), which sort in the same order as the encoded keys.
+	Bytes
+	// Text stores integer keys as unsigned decimal and UUID keys in
+	// canonical hyphenated form.
+	Text
+)
+
+func (f Format) String() string {
+	switch f {
+	case Int64:
+		return "int64"
+	case Bytes:
+		return "bytes"
+	case Text:
+		return "text"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// Column is a value that can be both written to and read from a
+// database/sql column.
+type Column interface {
+	driver.Valuer
+	sql.Scanner
+}
+
+// Errors returned by the conversions.
+var (
+	ErrNull        = errors.New("keysql: cannot scan NULL into an encoded key")
+	ErrFormat      = errors.New("keysql: unsupported format")
+	ErrSourceType  = errors.New("keysql: unsupported source type")
+	ErrSourceValue = errors.New("keysql: source value does not fit the key")
+)
+
+// UintValue converts the low `bits` bits of v (32 or 64) into a driver
+// value in format f.
+func UintValue(v uint64, bits int, f Format) (driver.Value, error) {
+	switch f {
+	case Int64:
+		return int64(v), nil
+	case Bytes:
+		return binary.BigEndian.AppendUint64(nil, v)[8-bits/8:], nil
+	case Text:
+		return strconv.FormatUint(v, 10), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrFormat, f)
+}
+
+// ScanUint converts src, read from a column written in format f, into a
+// key of the given width in bits (32 or 64).  Drivers that report
+// integers as text are tolerated for Int64 columns.
+func ScanUint(src any, bits int, f Format) (uint64, error) {
+	if src == nil {
+		return 0, ErrNull
+	}
+	max := uint64(1)<<bits - 1
+
+	switch f {
+	case Int64:
+		switch x := src.(type) {
+		case int64:
+			if bits == 64 {
+				return uint64(x), nil
+			}
+			if x < 0 || uint64(x) > max {
+				return 0, fmt.Errorf("%w: %d", ErrSourceValue, x)
+			}
+			return uint64(x), nil
+		case []byte:
+			return parseSigned(string(x), bits)
+		case string:
+			return parseSigned(x, bits)
+		}
+	case Bytes:
+		if b, ok := src.([]byte); ok {
+			if len(b) != bits/8 {
+				return 0, fmt.Errorf("%w: got %d bytes, want %d", ErrSourceValue, len(b), bits/8)
+			}
+			var buf [8]byte
+			copy(buf[8-len(b):], b)
+			return binary.BigEndian.Uint64(buf[:]), nil
+		}
+	case Text:
+		var s string
+		switch x := src.(type) {
+		case []byte:
+			s = string(x)
+		case string:
+			s = x
+		default:
+			return 0, fmt.Errorf("%w: %T for %s", ErrSourceType, src, f)
+		}
+		u, err := strconv.ParseUint(s, 10, bits)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrSourceValue, err)
+		}
+		return u, nil
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrFormat, f)
+	}
+	return 0, fmt.Errorf("%w: %T for %s", ErrSourceType, src, f)
+}
+
+// parseSigned parses a decimal integer as returned by drivers that report
+// BIGINT columns as text.
+func parseSigned(s string, bits int) (uint64, error) {
+	x, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrSourceValue, err)
+	}
+	return ScanUint(x, bits, Int64)
+}
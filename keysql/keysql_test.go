@@ -0,0 +1,72 @@
+package keysql
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUintValueRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		v    uint64
+		bits int
+		f    Format
+		want any
+	}{
+		{name: "int64-small", v: 42, bits: 64, f: Int64, want: int64(42)},
+		{name: "int64-top-bit", v: math.MaxUint64, bits: 64, f: Int64, want: int64(-1)},
+		{name: "int64-32bit", v: math.MaxUint32, bits: 32, f: Int64, want: int64(math.MaxUint32)},
+		{name: "bytes-64", v: 0x0102030405060708, bits: 64, f: Bytes, want: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		{name: "bytes-32", v: 0x01020304, bits: 32, f: Bytes, want: []byte{1, 2, 3, 4}},
+		{name: "text", v: math.MaxUint64, bits: 64, f: Text, want: "18446744073709551615"},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := UintValue(tc.v, tc.bits, tc.f)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+
+			back, err := ScanUint(got, tc.bits, tc.f)
+			require.NoError(t, err)
+			require.Equal(t, tc.v, back)
+		})
+	}
+}
+
+func TestScanUintErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     any
+		bits    int
+		f       Format
+		wantErr error
+	}{
+		{name: "null", src: nil, bits: 64, f: Int64, wantErr: ErrNull},
+		{name: "negative-32", src: int64(-1), bits: 32, f: Int64, wantErr: ErrSourceValue},
+		{name: "too-big-32", src: int64(math.MaxUint32 + 1), bits: 32, f: Int64, wantErr: ErrSourceValue},
+		{name: "float", src: 1.5, bits: 64, f: Int64, wantErr: ErrSourceType},
+		{name: "short-bytes", src: []byte{1, 2, 3}, bits: 32, f: Bytes, wantErr: ErrSourceValue},
+		{name: "string-bytes", src: "abcd", bits: 32, f: Bytes, wantErr: ErrSourceType},
+		{name: "bad-text", src: "12x", bits: 64, f: Text, wantErr: ErrSourceValue},
+		{name: "negative-text", src: "-1", bits: 64, f: Text, wantErr: ErrSourceValue},
+		{name: "text-overflow-32", src: "4294967296", bits: 32, f: Text, wantErr: ErrSourceValue},
+		{name: "unknown-format", src: int64(1), bits: 64, f: Format(9), wantErr: ErrFormat},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ScanUint(tc.src, tc.bits, tc.f)
+			require.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+
+	// drivers that report BIGINT as text
+	got, err := ScanUint([]byte("-1"), 64, Int64)
+	require.NoError(t, err)
+	require.Equal(t, uint64(math.MaxUint64), got)
+}
@@ -0,0 +1,58 @@
+package keystats
+
+import "math"
+
+// chiSquaredSurvival returns P(X >= x) for X chi-squared distributed with
+// dof degrees of freedom, i.e. the regularised upper incomplete gamma
+// function Q(dof/2, x/2).
+func chiSquaredSurvival(x float64, dof int) float64 {
+	if dof <= 0 || x <= 0 {
+		return 1
+	}
+	a, x := float64(dof)/2, x/2
+	lg, _ := math.Lgamma(a)
+	prefix := math.Exp(-x + a*math.Log(x) - lg)
+
+	const (
+		iterations = 10000
+		epsilon    = 1e-14
+		tiny       = 1e-300
+	)
+
+	if x < a+1 {
+		// series for the lower function P, then Q = 1 - P
+		sum, term := 1/a, 1/a
+		for n := 1; n < iterations; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*epsilon {
+				break
+			}
+		}
+		return max(0, 1-prefix*sum)
+	}
+
+	// modified Lentz continued fraction for Q
+	b := x + 1 - a
+	c, d := 1/tiny, 1/b
+	h := d
+	for n := 1; n < iterations; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return min(1, prefix*h)
+}
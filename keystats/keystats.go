@@ -0,0 +1,175 @@
+// Package keystats simulates how a workload of IDs spreads across shard
+// prefixes, so offset and size can be chosen from data instead of
+// guesswork.  It reports per-prefix counts, skew, a chi-squared test of
+// uniformity and how quickly writes rotate across shards over time.
+package keystats
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+	"time"
+)
+
+// Sample is one write: when it happened and which shard prefix it hit.
+type Sample struct {
+	At     time.Time
+	Prefix uint64
+}
+
+// MaxPrefixSize bounds the prefix width a Collector will track.
+const MaxPrefixSize = 24
+
+// ErrPrefixSize is returned for prefix widths outside [0, MaxPrefixSize].
+var ErrPrefixSize = errors.New("keystats: prefix size out of range")
+
+// Window summarises the samples in one time window.
+type Window struct {
+	Start    time.Time
+	Count    int
+	Prefixes int     // distinct prefixes written to
+	TopShare float64 // fraction of the window's writes on its busiest prefix
+}
+
+// Report summarises a workload.
+type Report struct {
+	PrefixSize int
+	Total      int
+	Counts     []uint64 // writes per prefix, indexed by prefix
+
+	Min, Max uint64  // smallest and largest per-prefix count
+	Skew     float64 // Max divided by the mean count; 1 is perfectly even
+
+	ChiSquared       float64 // Pearson's statistic against a uniform spread
+	DegreesOfFreedom int
+	PValue           float64 // probability of a spread at least this uneven if writes were uniform
+
+	Rotations int           // times consecutive writes moved to a different prefix
+	MeanDwell time.Duration // mean time writes stayed on one prefix before moving on
+	Windows   []Window
+}
+
+// Collector accumulates Samples into a Report.
+type Collector struct {
+	prefixSize int
+	window     time.Duration
+	counts     []uint64
+	total      int
+
+	first, last time.Time
+	runStart    time.Time
+	lastPrefix  uint64
+	rotations   int
+	dwell       time.Duration
+
+	windows []Window
+	seen    map[uint64]int // per-prefix counts in the current window
+}
+
+// NewCollector returns a Collector for prefixes of prefixSize bits that
+// groups samples into windows of the given length (no windows if zero).
+func NewCollector(prefixSize int, window time.Duration) (*Collector, error) {
+	if prefixSize < 0 || prefixSize > MaxPrefixSize {
+		return nil, fmt.Errorf("%w: %d", ErrPrefixSize, prefixSize)
+	}
+	return &Collector{
+		prefixSize: prefixSize,
+		window:     window,
+		counts:     make([]uint64, 1<<prefixSize),
+		seen:       make(map[uint64]int),
+	}, nil
+}
+
+// Add records s.  Samples must arrive in time order.
+func (c *Collector) Add(s Sample) {
+	p := s.Prefix & (1<<c.prefixSize - 1)
+	if c.total == 0 {
+		c.first, c.runStart, c.lastPrefix = s.At, s.At, p
+	} else if p != c.lastPrefix {
+		c.rotations++
+		c.dwell += s.At.Sub(c.runStart)
+		c.runStart, c.lastPrefix = s.At, p
+	}
+	c.counts[p]++
+	c.total++
+	c.last = s.At
+
+	if c.window > 0 {
+		start := c.first.Add(s.At.Sub(c.first).Truncate(c.window))
+		if n := len(c.windows); n == 0 || !c.windows[n-1].Start.Equal(start) {
+			c.closeWindow()
+			c.windows = append(c.windows, Window{Start: start})
+		}
+		w := &c.windows[len(c.windows)-1]
+		w.Count++
+		c.seen[p]++
+	}
+}
+
+// closeWindow finalises the current window's distinct and top-share stats.
+func (c *Collector) closeWindow() {
+	if len(c.windows) == 0 {
+		return
+	}
+	w := &c.windows[len(c.windows)-1]
+	top := 0
+	for _, n := range c.seen {
+		top = max(top, n)
+	}
+	w.Prefixes = len(c.seen)
+	if w.Count > 0 {
+		w.TopShare = float64(top) / float64(w.Count)
+	}
+	clear(c.seen)
+}
+
+// Report returns the statistics for every sample added so far.
+func (c *Collector) Report() Report {
+	c.closeWindow()
+
+	r := Report{
+		PrefixSize:       c.prefixSize,
+		Total:            c.total,
+		Counts:           append([]uint64(nil), c.counts...),
+		DegreesOfFreedom: len(c.counts) - 1,
+		Rotations:        c.rotations,
+		Windows:          append([]Window(nil), c.windows...),
+	}
+	if c.total == 0 {
+		return r
+	}
+
+	r.Min = math.MaxUint64
+	mean := float64(c.total) / float64(len(c.counts))
+	for _, n := range c.counts {
+		r.Min, r.Max = min(r.Min, n), max(r.Max, n)
+		d := float64(n) - mean
+		r.ChiSquared += d * d / mean
+	}
+	r.Skew = float64(r.Max) / mean
+	r.PValue = chiSquaredSurvival(r.ChiSquared, r.DegreesOfFreedom)
+
+	// only completed runs have a known length unless nothing ever moved
+	if c.rotations > 0 {
+		r.MeanDwell = c.dwell / time.Duration(c.rotations)
+	} else {
+		r.MeanDwell = c.last.Sub(c.first)
+	}
+	return r
+}
+
+// Analyze collects every sample of src, stopping at the first error.
+func Analyze(prefixSize int, window time.Duration, src iter.Seq2[Sample, error]) (Report, error) {
+	c, err := NewCollector(prefixSize, window)
+	if err != nil {
+		return Report{}, err
+	}
+	for s, err := range src {
+		if err != nil {
+			return Report{}, err
+		}
+		c.Add(s)
+	}
+	return c.Report(), nil
+}
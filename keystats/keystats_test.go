@@ -0,0 +1,163 @@
+package keystats
+
+import (
+	"errors"
+	"iter"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sean-/go-sharded-cluster-keys/key32"
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+	"github.com/sean-/go-sharded-cluster-keys/key64/gen"
+	"github.com/sean-/go-sharded-cluster-keys/keyuuid"
+)
+
+var begin = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestNewCollectorPrefixSize(t *testing.T) {
+	_, err := NewCollector(-1, 0)
+	require.ErrorIs(t, err, ErrPrefixSize)
+	_, err = NewCollector(MaxPrefixSize+1, 0)
+	require.ErrorIs(t, err, ErrPrefixSize)
+	_, err = NewCollector(MaxPrefixSize, 0)
+	require.NoError(t, err)
+}
+
+func TestEmptyReport(t *testing.T) {
+	c, err := NewCollector(4, time.Second)
+	require.NoError(t, err)
+	r := c.Report()
+	require.Equal(t, 0, r.Total)
+	require.Len(t, r.Counts, 16)
+	require.Empty(t, r.Windows)
+}
+
+func TestSequentialLowBits(t *testing.T) {
+	// with offset 0 consecutive IDs land on consecutive prefixes
+	const n = 16 * 100
+	r, err := Analyze(4, time.Second, Workload(Steady(begin, 1000, n), Sequential(Key64(key64.MustNewEncoder(0, 4)), 0)))
+	require.NoError(t, err)
+
+	require.Equal(t, n, r.Total)
+	require.Equal(t, uint64(100), r.Min)
+	require.Equal(t, uint64(100), r.Max)
+	require.Equal(t, 1.0, r.Skew)
+	require.Zero(t, r.ChiSquared)
+	require.Equal(t, 15, r.DegreesOfFreedom)
+	require.Equal(t, 1.0, r.PValue)
+	require.Equal(t, n-1, r.Rotations)
+	require.Equal(t, time.Millisecond, r.MeanDwell)
+
+	require.Len(t, r.Windows, 2)
+	require.Equal(t, begin, r.Windows[0].Start)
+	require.Equal(t, 1000, r.Windows[0].Count)
+	require.Equal(t, 16, r.Windows[0].Prefixes)
+	require.Equal(t, 600, r.Windows[1].Count)
+}
+
+func TestSequentialDwell(t *testing.T) {
+	// offset 8: each prefix holds 256 consecutive IDs, 256ms at 1000/s
+	const n = 16 * 256
+	r, err := Analyze(4, time.Second, Workload(Steady(begin, 1000, n), Sequential(Key32(key32.MustNewEncoder(8, 4)), 0)))
+	require.NoError(t, err)
+
+	require.Equal(t, 1.0, r.Skew)
+	require.Equal(t, 15, r.Rotations)
+	require.Equal(t, 256*time.Millisecond, r.MeanDwell)
+	for _, w := range r.Windows[:4] {
+		require.LessOrEqual(t, w.Prefixes, 5)
+		require.Greater(t, w.TopShare, 0.25)
+	}
+}
+
+func TestSkewed(t *testing.T) {
+	// offset 12 with only 4096 IDs never leaves prefix 0
+	r, err := Analyze(4, 0, Workload(Steady(begin, 1000, 4096), Sequential(Key64(key64.MustNewEncoder(12, 4)), 0)))
+	require.NoError(t, err)
+
+	require.Equal(t, uint64(0), r.Min)
+	require.Equal(t, uint64(4096), r.Max)
+	require.Equal(t, 16.0, r.Skew)
+	require.Equal(t, 0, r.Rotations)
+	require.Less(t, r.PValue, 1e-9)
+	require.Empty(t, r.Windows)
+}
+
+func TestChiSquaredSurvival(t *testing.T) {
+	// critical values at the 5% level
+	testCases := []struct {
+		x   float64
+		dof int
+	}{
+		{3.841, 1},
+		{5.991, 2},
+		{18.307, 10},
+		{124.342, 100},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		require.InDelta(t, 0.05, chiSquaredSurvival(tc.x, tc.dof), 1e-3, "x=%v dof=%d", tc.x, tc.dof)
+	}
+	require.Equal(t, 1.0, chiSquaredSurvival(0, 5))
+	require.InDelta(t, 0.5, chiSquaredSurvival(8191-2.0/3, 8191), 0.01)
+}
+
+func TestPoissonSnowflake(t *testing.T) {
+	enc := key64.MustNewEncoder(22+8, 6)
+	k, err := Snowflake(gen.Config{
+		Encoder:      enc,
+		Epoch:        begin,
+		WorkerBits:   10,
+		SequenceBits: 12,
+	})
+	require.NoError(t, err)
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	r, err := Analyze(enc.PrefixSize(), 10*time.Second, Workload(Poisson(begin, 500, 50_000, rng), k))
+	require.NoError(t, err)
+
+	// ~100s of writes rotate through a new prefix every 256ms
+	require.Equal(t, 50_000, r.Total)
+	require.InDelta(t, 256*time.Millisecond, r.MeanDwell, float64(20*time.Millisecond))
+	require.Less(t, r.Skew, 1.3)
+	require.InDelta(t, 10, len(r.Windows), 1)
+}
+
+func TestUUIDv7(t *testing.T) {
+	enc := keyuuid.NewUUIDv7Encoder()
+	rng := rand.New(rand.NewPCG(3, 4))
+	src := Workload(Poisson(begin, 1000, 20_000, rng), UUIDv7(enc, rand.NewChaCha8([32]byte{})))
+	r, err := Analyze(enc.PrefixSize(), time.Second, src)
+	require.NoError(t, err)
+
+	// 2^11ms per prefix, 16 prefixes: a ~20s run covers about 10 of them
+	require.Equal(t, 20_000, r.Total)
+	require.InDelta(t, 2048*time.Millisecond, r.MeanDwell, float64(300*time.Millisecond))
+	for _, w := range r.Windows {
+		require.LessOrEqual(t, w.Prefixes, 2)
+	}
+}
+
+func TestWorkloadError(t *testing.T) {
+	boom := errors.New("boom")
+	k := func(at time.Time) (uint64, error) {
+		if at.After(begin.Add(time.Second)) {
+			return 0, boom
+		}
+		return 0, nil
+	}
+	_, err := Analyze(4, 0, Workload(Steady(begin, 10, 100), k))
+	require.ErrorIs(t, err, boom)
+}
+
+func TestWorkloadStop(t *testing.T) {
+	next, stop := iter.Pull2(Workload(Steady(begin, 1, 10), Sequential(func(v uint64) uint64 { return v }, 7)))
+	defer stop()
+	s, err, ok := next()
+	require.True(t, ok)
+	require.NoError(t, err)
+	require.Equal(t, Sample{At: begin, Prefix: 7}, s)
+}
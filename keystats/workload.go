@@ -0,0 +1,134 @@
+package keystats
+
+import (
+	"io"
+	"iter"
+	"math/rand/v2"
+	"time"
+
+	"github.com/sean-/go-sharded-cluster-keys/key32"
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+	"github.com/sean-/go-sharded-cluster-keys/key64/gen"
+	"github.com/sean-/go-sharded-cluster-keys/keyuuid"
+)
+
+// PrefixFunc maps an original (unencoded) integer ID to its shard prefix.
+type PrefixFunc func(v uint64) uint64
+
+// Key32 returns the PrefixFunc of a key32 encoder.  IDs are truncated to
+// 32 bits.
+func Key32(enc key32.Encoder) PrefixFunc {
+	return func(v uint64) uint64 {
+		return uint64(enc.Prefix(enc.Encode(uint32(v))))
+	}
+}
+
+// Key64 returns the PrefixFunc of a key64 encoder.
+func Key64(enc key64.Encoder) PrefixFunc {
+	return func(v uint64) uint64 {
+		return enc.Prefix(enc.Encode(v))
+	}
+}
+
+// Keyer mints the ID for a write arriving at the given time and returns
+// its shard prefix.
+type Keyer func(at time.Time) (uint64, error)
+
+// Sequential returns a Keyer that hands out start, start+1, ... regardless
+// of time, like an auto-increment column.
+func Sequential(pf PrefixFunc, start uint64) Keyer {
+	next := start
+	return func(time.Time) (uint64, error) {
+		v := next
+		next++
+		return pf(v), nil
+	}
+}
+
+// Snowflake returns a Keyer backed by a key64/gen Generator whose clock is
+// the arrival time.  cfg.Now and cfg.Sleep are replaced; a sleep while the
+// sequence is exhausted pushes later IDs forward in time as it would in
+// production.
+func Snowflake(cfg gen.Config) (Keyer, error) {
+	var now time.Time
+	cfg.Now = func() time.Time { return now }
+	cfg.Sleep = func(d time.Duration) { now = now.Add(d) }
+	g, err := gen.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	enc := cfg.Encoder
+	return func(at time.Time) (uint64, error) {
+		if at.After(now) {
+			now = at
+		}
+		v, err := g.Next()
+		if err != nil {
+			return 0, err
+		}
+		return enc.Prefix(v), nil
+	}, nil
+}
+
+// UUIDv7 returns a Keyer that mints UUIDv7 values stamped with the arrival
+// time.  A nil entropy reads from crypto/rand.
+func UUIDv7(enc keyuuid.Encoder, entropy io.Reader) Keyer {
+	var now time.Time
+	g := keyuuid.NewUUIDv7Generator(keyuuid.GeneratorConfig{
+		Encoder: enc,
+		Now:     func() time.Time { return now },
+		Entropy: entropy,
+	})
+	return func(at time.Time) (uint64, error) {
+		now = at
+		v, err := g.Next()
+		if err != nil {
+			return 0, err
+		}
+		return enc.PrefixBits(v), nil
+	}
+}
+
+// Steady yields n arrival times spaced exactly 1/rate seconds apart,
+// starting at begin.
+func Steady(begin time.Time, rate float64, n int) iter.Seq[time.Time] {
+	step := time.Duration(float64(time.Second) / rate)
+	return func(yield func(time.Time) bool) {
+		for i := range n {
+			if !yield(begin.Add(time.Duration(i) * step)) {
+				return
+			}
+		}
+	}
+}
+
+// Poisson yields n arrival times of a Poisson process averaging rate
+// arrivals per second, starting at begin.
+func Poisson(begin time.Time, rate float64, n int, rng *rand.Rand) iter.Seq[time.Time] {
+	return func(yield func(time.Time) bool) {
+		at := begin
+		for range n {
+			at = at.Add(time.Duration(rng.ExpFloat64() / rate * float64(time.Second)))
+			if !yield(at) {
+				return
+			}
+		}
+	}
+}
+
+// Workload pairs every arrival with the prefix k mints for it.  It stops
+// after the first error, which it yields with a zero Sample.
+func Workload(arrivals iter.Seq[time.Time], k Keyer) iter.Seq2[Sample, error] {
+	return func(yield func(Sample, error) bool) {
+		for at := range arrivals {
+			p, err := k(at)
+			if err != nil {
+				yield(Sample{}, err)
+				return
+			}
+			if !yield(Sample{At: at, Prefix: p}, nil) {
+				return
+			}
+		}
+	}
+}
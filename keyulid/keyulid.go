@@ -0,0 +1,100 @@
+// Package keyulid shard-encodes ULIDs natively: it accepts and returns
+// ulid.ULID values and prints them in Crockford base32, while sharing the
+// bit layout and encoding of keyuuid.
+package keyulid
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
+
+	"github.com/sean-/go-sharded-cluster-keys/keyuuid"
+)
+
+// Value is an encoded ULID.
+type Value ulid.ULID
+
+// String returns v in 26-character Crockford base32.
+func (v Value) String() string { return ulid.ULID(v).String() }
+
+// ULID returns v as a plain ulid.ULID, e.g. for storage.
+func (v Value) ULID() ulid.ULID { return ulid.ULID(v) }
+
+// Parse parses an encoded ULID in Crockford base32.
+func Parse(s string) (Value, error) {
+	u, err := ulid.ParseStrict(s)
+	return Value(u), err
+}
+
+// ID is a decoded ULID.
+type ID ulid.ULID
+
+// String returns id in 26-character Crockford base32.
+func (id ID) String() string { return ulid.ULID(id).String() }
+
+// ULID returns id as a plain ulid.ULID.
+func (id ID) ULID() ulid.ULID { return ulid.ULID(id) }
+
+// Timestamp returns the creation time carried in id's top 48 bits.
+func (id ID) Timestamp() time.Time { return ulid.Time(ulid.ULID(id).Time()) }
+
+// Encoder mirrors keyuuid.Encoder over ulid.ULID.
+type Encoder interface {
+	Encode(u ulid.ULID) Value
+	Decode(v Value) ID
+	Prefix(v Value) uint64 // top PrefixSize bits as an integer
+	LeftSize() int         // bits to the right of the prefix
+	PrefixSize() int       // number of bits in the prefix
+	RightSize() int        // bits left of the prefix
+}
+
+// encoder adapts a keyuuid.Encoder; ULIDs and UUIDs share one 128-bit
+// big-endian layout, so no bytes are copied or converted.
+type encoder struct {
+	enc keyuuid.Encoder
+}
+
+// NewEncoder returns an Encoder with keyuuid.NewULIDEncoder's layout.
+func NewEncoder() Encoder {
+	return encoder{keyuuid.NewULIDEncoder()}
+}
+
+// NewEncoderE returns an Encoder with a custom layout; see
+// keyuuid.NewEncoderE.
+func NewEncoderE(totalBits, maskOffset, prefixSize int) (Encoder, error) {
+	enc, err := keyuuid.NewEncoderE(totalBits, maskOffset, prefixSize)
+	if err != nil {
+		return nil, err
+	}
+	return encoder{enc}, nil
+}
+
+// Wrap adapts an existing keyuuid.Encoder.
+func Wrap(enc keyuuid.Encoder) Encoder {
+	return encoder{enc}
+}
+
+func (e encoder) Encode(u ulid.ULID) Value { return Value(e.enc.Encode(uuid.UUID(u))) }
+func (e encoder) Decode(v Value) ID        { return ID(e.enc.Decode(uuid.UUID(v))) }
+func (e encoder) Prefix(v Value) uint64    { return e.enc.PrefixBits(uuid.UUID(v)) }
+func (e encoder) LeftSize() int            { return e.enc.LeftSize() }
+func (e encoder) PrefixSize() int          { return e.enc.PrefixSize() }
+func (e encoder) RightSize() int           { return e.enc.RightSize() }
+
+// Generator mints monotonic, shard-encoded ULIDs; see keyuuid.ULIDGenerator.
+type Generator struct {
+	g *keyuuid.ULIDGenerator
+}
+
+// NewGenerator returns a Generator for cfg.  A nil cfg.Encoder defaults to
+// keyuuid.NewULIDEncoder.
+func NewGenerator(cfg keyuuid.GeneratorConfig) *Generator {
+	return &Generator{keyuuid.NewULIDGenerator(cfg)}
+}
+
+// Next returns the next encoded ULID.
+func (g *Generator) Next() (Value, error) {
+	v, err := g.g.Next()
+	return Value(v), err
+}
@@ -0,0 +1,73 @@
+package keyulid
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sean-/go-sharded-cluster-keys/keyuuid"
+)
+
+func TestEncoderMatchesKeyUUID(t *testing.T) {
+	u := ulid.MustParse("01ARYZ6S41TSV4RRFFQ69G5FAV")
+	enc := NewEncoder()
+
+	v := enc.Encode(u)
+	want := keyuuid.NewULIDEncoder().Encode(uuid.UUID(u))
+	require.Equal(t, [16]byte(want), [16]byte(v))
+	require.Equal(t, keyuuid.NewULIDEncoder().PrefixBits(want), enc.Prefix(v))
+
+	id := enc.Decode(v)
+	require.Equal(t, u, id.ULID())
+	require.Equal(t, "01ARYZ6S41TSV4RRFFQ69G5FAV", id.String())
+	require.Equal(t, ulid.Time(u.Time()), id.Timestamp())
+
+	// metadata mirrors keyuuid
+	require.Equal(t, 16, enc.RightSize())
+	require.Equal(t, 16, enc.PrefixSize())
+	require.Equal(t, 16, enc.LeftSize())
+}
+
+func TestValueString(t *testing.T) {
+	u := ulid.MustParse("01ARYZ6S41TSV4RRFFQ69G5FAV")
+	v := NewEncoder().Encode(u)
+
+	s := v.String()
+	require.Len(t, s, ulid.EncodedSize)
+	require.NotContains(t, s, "-")
+
+	parsed, err := Parse(s)
+	require.NoError(t, err)
+	require.Equal(t, v, parsed)
+	require.Equal(t, ulid.ULID(v), parsed.ULID())
+
+	_, err = Parse("not-a-ulid")
+	require.Error(t, err)
+}
+
+func TestNewEncoderE(t *testing.T) {
+	enc, err := NewEncoderE(48, 11, 4)
+	require.NoError(t, err)
+	require.Equal(t, 4, enc.PrefixSize())
+
+	_, err = NewEncoderE(65, 0, 4)
+	require.ErrorIs(t, err, keyuuid.ErrLayoutOverflow)
+}
+
+func TestGenerator(t *testing.T) {
+	now := time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC)
+	g := NewGenerator(keyuuid.GeneratorConfig{Now: func() time.Time { return now }})
+	enc := NewEncoder()
+
+	v1, err := g.Next()
+	require.NoError(t, err)
+	v2, err := g.Next()
+	require.NoError(t, err)
+
+	id1, id2 := enc.Decode(v1), enc.Decode(v2)
+	require.Equal(t, now, id1.Timestamp().UTC())
+	require.Equal(t, -1, id1.ULID().Compare(id2.ULID()))
+}
@@ -0,0 +1,56 @@
+package keyuuid
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the shard byte-range helpers.
+var (
+	ErrUnaligned   = errors.New("keyuuid: prefix size is not a whole number of bytes")
+	ErrPrefixRange = errors.New("keyuuid: prefix out of range")
+)
+
+// AppendBinary appends the 16 raw bytes of v.  Value is a uuid.UUID, whose
+// MarshalBinary and UnmarshalBinary already use this form: byte-wise order
+// equals the order of encoded Values read as 128-bit big-endian integers,
+// so an ordered key-value store keeps every shard contiguous.
+func AppendBinary(b []byte, v Value) []byte {
+	return append(b, v[:]...)
+}
+
+// ShardBounds returns the binary key range [start, end) holding every
+// Value whose prefix under e is prefix, for range scans of an ordered
+// store.  end is nil for the last shard, meaning "to the end".
+func ShardBounds(e Encoder, prefix uint64) (start, end []byte, err error) {
+	size := e.PrefixSize()
+	shift := 64 - size
+	last := ^uint64(0) >> shift // a shift of 64 leaves zero
+	if prefix > last {
+		return nil, nil, fmt.Errorf("%w: %d needs more than %d bits", ErrPrefixRange, prefix, size)
+	}
+	start = binary.BigEndian.AppendUint64(nil, prefix<<shift)
+	start = append(start, make([]byte, 8)...)
+	if prefix != last {
+		end = binary.BigEndian.AppendUint64(nil, (prefix+1)<<shift)
+		end = append(end, make([]byte, 8)...)
+	}
+	return start, end, nil
+}
+
+// ShardPrefix returns the leading bytes shared by every binary Value in
+// shard prefix, for stores with prefix iteration.  It returns ErrUnaligned
+// unless e's prefix size is a multiple of 8; use ShardBounds otherwise.
+func ShardPrefix(e Encoder, prefix uint64) ([]byte, error) {
+	size := e.PrefixSize()
+	if size%8 != 0 {
+		return nil, fmt.Errorf("%w: %d bits", ErrUnaligned, size)
+	}
+	shift := 64 - size
+	if prefix > ^uint64(0)>>shift {
+		return nil, fmt.Errorf("%w: %d needs more than %d bits", ErrPrefixRange, prefix, size)
+	}
+	full := binary.BigEndian.AppendUint64(nil, prefix<<shift)
+	return full[:size/8], nil
+}
@@ -0,0 +1,84 @@
+package keyuuid
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ErrVersion is returned when a constructor is handed a UUID of the wrong
+// version or variant.
+var ErrVersion = errors.New("keyuuid: unexpected UUID version")
+
+// identityEncoder leaves all 128 bits untouched; it backs New and the zero Key.
+var identityEncoder = NewEncoder(0, 0, 0)
+
+// Key is an encoded UUID together with the Encoder that produced it, so the
+// original value and shard prefix can always be recovered.
+type Key struct {
+	enc Encoder
+	v   Value
+}
+
+// NewKey encodes u with enc.
+func NewKey(enc Encoder, u uuid.UUID) Key {
+	return Key{enc: enc, v: enc.Encode(u)}
+}
+
+// New wraps any UUID (v1–v5, v7, etc.) without further validation, using
+// the identity encoder.
+func New(u uuid.UUID) Key {
+	return NewKey(identityEncoder, u)
+}
+
+// NewFromUUIDv7 accepts a UUIDv7 and returns a Key encoded with
+// NewUUIDv7Encoder, or ErrVersion if u is not an RFC 9562 version 7 UUID.
+func NewFromUUIDv7(u uuid.UUID) (Key, error) {
+	if u.Version() != 7 || u.Variant() != uuid.RFC4122 {
+		return Key{}, fmt.Errorf("%w: got version %d variant %s, want version 7",
+			ErrVersion, u.Version(), u.Variant())
+	}
+	return NewKey(NewUUIDv7Encoder(), u), nil
+}
+
+// NewFromULID accepts a ULID’s 16-byte array and returns a Key encoded with
+// NewULIDEncoder.  ULIDs and UUIDs share the same 128-bit big-endian layout,
+// so the bytes are reinterpreted as-is.  Every 16-byte array is a valid ULID,
+// so NewFromULID never fails today; the error result mirrors NewFromUUIDv7
+// so callers can treat both sources alike.
+func NewFromULID(b [16]byte) (Key, error) {
+	return NewKey(NewULIDEncoder(), uuid.UUID(b)), nil
+}
+
+func (k Key) encoder() Encoder {
+	if k.enc == nil {
+		return identityEncoder
+	}
+	return k.enc
+}
+
+// Encoder returns the Encoder k was encoded with.
+func (k Key) Encoder() Encoder {
+	return k.encoder()
+}
+
+// UUID returns the encoded UUID, suitable for use as a sharded primary key.
+func (k Key) UUID() uuid.UUID {
+	return k.v
+}
+
+// Decoded returns the original UUID that was passed to the constructor.
+func (k Key) Decoded() uuid.UUID {
+	return k.encoder().Decode(k.v)
+}
+
+// Prefix returns the shard prefix of the encoded UUID (other bits zeroed).
+func (k Key) Prefix() uuid.UUID {
+	return k.encoder().Prefix(k.v)
+}
+
+// String returns the canonical dash-form of the encoded UUID.
+func (k Key) String() string {
+	return k.v.String()
+}
@@ -2,8 +2,13 @@ package keyuuid
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/sean-/go-sharded-cluster-keys/keybits"
 )
 
 // Value is the encoded form—a standard 16-byte UUID.
@@ -13,34 +18,108 @@ type Value = uuid.UUID
 type Encoder interface {
 	Encode(v uuid.UUID) Value
 	Decode(v Value) uuid.UUID
-	Prefix(v Value) uuid.UUID // top bits, still as a UUID (with other bits zeroed)
-	LeftSize() int            // bits to the right of the prefix
-	PrefixSize() int          // number of bits in the prefix
-	RightSize() int           // bits left of the prefix
+	Prefix(v Value) uuid.UUID  // top bits, still as a UUID (with other bits zeroed)
+	PrefixBits(v Value) uint64 // top bits as an integer in [0, 2^PrefixSize)
+	LeftSize() int             // bits to the right of the prefix
+	PrefixSize() int           // number of bits in the prefix
+	RightSize() int            // bits left of the prefix
+
+	// EncodedRanges returns the minimal sorted set of encoded UUID ranges
+	// covering every UUID whose top totalBits lie in [lo, hi].  The identity
+	// encoder treats the whole first 8 bytes as the field.
+	EncodedRanges(lo, hi uint64) []Range
+
+	// TimeRanges is EncodedRanges for the UUIDv7/ULID millisecond timestamp
+	// in [from, to).  It returns ErrNoTimestamp unless totalBits is 48.
+	TimeRanges(from, to time.Time) ([]Range, error)
+
+	// EncodeSlice encodes src into dst, which must be at least as long
+	// as src.  It is Encode without a dynamic call per element.
+	EncodeSlice(dst []Value, src []uuid.UUID)
+
+	// DecodeSlice decodes src into dst, which must be at least as long
+	// as src.
+	DecodeSlice(dst []uuid.UUID, src []Value)
 }
 
+// Range is an inclusive interval [Lo, Hi] of encoded UUIDs, compared as
+// 128-bit big-endian integers.
+type Range struct {
+	Lo, Hi Value
+}
+
+// ErrNoTimestamp is returned by TimeRanges for layouts that do not cover a
+// 48-bit millisecond timestamp.
+var ErrNoTimestamp = errors.New("keyuuid: layout has no 48-bit timestamp")
+
+// timestampBits is the width of the UUIDv7/ULID millisecond timestamp.
+const timestampBits = 48
+
 // encoder is the concrete
 type encoder struct {
 	totalBits  int // 0 means “identity over 128 bits”, otherwise ≤64
 	maskOffset int // offset within that field
 	prefixSize int // how many bits to extract & reverse
+
+	bits keybits.Encoder[uint64] // shuffles the top totalBits of the MSB
+}
+
+func newEncoder(totalBits, maskOffset, prefixSize int) encoder {
+	return encoder{
+		totalBits:  totalBits,
+		maskOffset: maskOffset,
+		prefixSize: prefixSize,
+		bits:       keybits.NewEncoderWidth[uint64](totalBits, maskOffset, prefixSize),
+	}
 }
 
 // NewEncoder lets you make any UUID‐based encoder.
 // totalBits ≤ 64, maskOffset+prefixSize ≤ totalBits.
+// The layout is not validated; see NewEncoderE.
 func NewEncoder(totalBits, maskOffset, prefixSize int) Encoder {
-	return encoder{totalBits, maskOffset, prefixSize}
+	return newEncoder(totalBits, maskOffset, prefixSize)
+}
+
+// Errors returned by NewEncoderE for layouts that cannot be encoded.
+// They are the keybits sentinels, so errors.Is matches either name;
+// NewEncoderE prefixes the message with "keyuuid: ".
+var (
+	ErrNegativeOffset = keybits.ErrNegativeOffset
+	ErrNegativeSize   = keybits.ErrNegativeSize
+	ErrLayoutOverflow = keybits.ErrLayoutOverflow
+)
+
+// NewEncoderE is like NewEncoder but rejects layouts where totalBits is
+// outside [0,64] or the shard segment does not fit inside totalBits.
+func NewEncoderE(totalBits, maskOffset, prefixSize int) (Encoder, error) {
+	if totalBits < 0 {
+		return nil, fmt.Errorf("keyuuid: %w: totalBits=%d", ErrNegativeSize, totalBits)
+	}
+	e := newEncoder(totalBits, maskOffset, prefixSize)
+	if err := e.bits.Validate(); err != nil {
+		return nil, fmt.Errorf("keyuuid: %w", err)
+	}
+	return e, nil
+}
+
+// MustNewEncoder is like NewEncoderE but panics if the layout is invalid.
+func MustNewEncoder(totalBits, maskOffset, prefixSize int) Encoder {
+	e, err := NewEncoderE(totalBits, maskOffset, prefixSize)
+	if err != nil {
+		panic(err)
+	}
+	return e
 }
 
 // NewUUIDv7Encoder: extract the top 48 bits as timestamp, reverse 4 bits at offset 11
 func NewUUIDv7Encoder() Encoder {
-	return encoder{48, 11, 4}
+	return newEncoder(48, 11, 4)
 }
 
 // NewULIDEncoder: ULID also puts its 48-bit timestamp in the top 48 bits,
 // and we reverse the low 16 of that if you like (or pick any shard size).
 func NewULIDEncoder() Encoder {
-	return encoder{48 /*shard offset*/, 16 /*shard size*/, 16}
+	return newEncoder(48 /*shard offset*/, 16 /*shard size*/, 16)
 }
 
 func (e encoder) LeftSize() int {
@@ -59,71 +138,76 @@ func (e encoder) RightSize() int {
 	return e.maskOffset
 }
 
+// identity reports whether e leaves all 128 bits untouched.
+func (e encoder) identity() bool {
+	return e.totalBits == 0 && e.maskOffset == 0 && e.prefixSize == 0
+}
+
 // Encode plucks off the prefixSize bits starting at maskOffset within the top totalBits,
 // reverses them, and prepends into a standard UUID’s MSB.
 func (e encoder) Encode(u uuid.UUID) Value {
-	// identity over full 128 bits?
-	if e.totalBits == 0 && e.maskOffset == 0 && e.prefixSize == 0 {
+	if e.identity() {
 		return u
 	}
-	// pull MSB=first 8 bytes as uint64
-	msb := binary.BigEndian.Uint64(u[0:8])
-	// isolate the “target” field (the top totalBits of msb)
-	target := msb >> (64 - e.totalBits)
-
-	mask := uint64((1 << e.prefixSize) - 1)
-	field := (target >> e.maskOffset) & mask
-	rev := reverseBits(field, e.prefixSize)
-
-	left := (target >> (e.maskOffset + e.prefixSize)) // the high bits above the field
-	right := target & ((1 << e.maskOffset) - 1)       // the low bits below it
-
-	// reassemble into a shifted-down 48-bit, then back into msb
-	encoded48 := (rev << (e.totalBits - e.prefixSize)) |
-		(left << (e.maskOffset)) |
-		right
-	newMSB := (encoded48 << (64 - e.totalBits)) |
-		(msb & ((1 << (64 - e.totalBits)) - 1))
-
-	var out uuid.UUID
-	binary.BigEndian.PutUint64(out[0:8], newMSB)
-	copy(out[8:], u[8:])
-	return out
+	return e.withField(u, e.bits.Encode(e.field(u)))
 }
 
 // Decode inverts Encode.
 func (e encoder) Decode(u uuid.UUID) uuid.UUID {
-	// identity over full 128 bits?
-	if e.totalBits == 0 && e.maskOffset == 0 && e.prefixSize == 0 {
+	if e.identity() {
 		return u
 	}
+	return e.withField(u, e.bits.Decode(e.field(u)))
+}
 
-	msb := binary.BigEndian.Uint64(u[0:8])
-	target := msb >> (64 - e.totalBits)
-
-	mask := uint64((1 << e.prefixSize) - 1)
-	rev := (target >> (e.totalBits - e.prefixSize)) & mask
-	field := reverseBits(rev, e.prefixSize)
+// EncodeSlice implements Encoder.EncodeSlice
+func (e encoder) EncodeSlice(dst []Value, src []uuid.UUID) {
+	if len(dst) < len(src) {
+		panic("keyuuid: EncodeSlice: dst shorter than src")
+	}
+	if e.identity() {
+		copy(dst, src)
+		return
+	}
+	dst = dst[:len(src)]
+	for i, u := range src {
+		dst[i] = e.withField(u, e.bits.Encode(e.field(u)))
+	}
+}
 
-	left := (target >> e.maskOffset) & ((1 << (e.totalBits - e.maskOffset - e.prefixSize)) - 1)
-	right := target & ((1 << e.maskOffset) - 1)
+// DecodeSlice implements Encoder.DecodeSlice
+func (e encoder) DecodeSlice(dst []uuid.UUID, src []Value) {
+	if len(dst) < len(src) {
+		panic("keyuuid: DecodeSlice: dst shorter than src")
+	}
+	if e.identity() {
+		copy(dst, src)
+		return
+	}
+	dst = dst[:len(src)]
+	for i, u := range src {
+		dst[i] = e.withField(u, e.bits.Decode(e.field(u)))
+	}
+}
 
-	decoded48 := (left << (e.maskOffset + e.prefixSize)) |
-		(field << e.maskOffset) |
-		right
-	newMSB := (decoded48 << (64 - e.totalBits)) |
-		(msb & ((1 << (64 - e.totalBits)) - 1))
+// field returns the top totalBits of u's first 8 bytes.
+func (e encoder) field(u uuid.UUID) uint64 {
+	return binary.BigEndian.Uint64(u[0:8]) >> (64 - e.totalBits)
+}
 
-	var out uuid.UUID
-	binary.BigEndian.PutUint64(out[0:8], newMSB)
-	copy(out[8:], u[8:])
-	return out
+// withField replaces the top totalBits of u's first 8 bytes with f and
+// leaves every other bit as-is.
+func (e encoder) withField(u uuid.UUID, f uint64) uuid.UUID {
+	shift := 64 - e.totalBits
+	msb := binary.BigEndian.Uint64(u[0:8])
+	binary.BigEndian.PutUint64(u[0:8], f<<shift|msb&(1<<shift-1))
+	return u
 }
 
 // Prefix returns the high prefixSize bits of the encoded UUID (others zeroed).
 func (e encoder) Prefix(u uuid.UUID) uuid.UUID {
 	// identity => zero prefix
-	if e.totalBits == 0 && e.maskOffset == 0 && e.prefixSize == 0 {
+	if e.identity() {
 		return uuid.UUID{}
 	}
 
@@ -138,11 +222,56 @@ func (e encoder) Prefix(u uuid.UUID) uuid.UUID {
 	return out
 }
 
-func reverseBits(x uint64, bitCount int) uint64 {
-	var out uint64
-	for i := 0; i < bitCount; i++ {
-		out <<= 1
-		out |= (x >> i) & 1
+// PrefixBits returns the high prefixSize bits of the encoded UUID as an
+// integer, for routing with shardmap and friends.
+func (e encoder) PrefixBits(u uuid.UUID) uint64 {
+	if e.identity() {
+		return 0
+	}
+	msb := binary.BigEndian.Uint64(u[0:8])
+	return (msb >> (64 - e.prefixSize)) & ((1 << e.prefixSize) - 1)
+}
+
+// EncodedRanges implements Encoder.EncodedRanges
+func (e encoder) EncodedRanges(lo, hi uint64) []Range {
+	bits, shift := e.bits, 64-e.totalBits
+	if e.identity() {
+		bits, shift = keybits.NewEncoder[uint64](0, 0), 0
+	}
+
+	ranges := bits.EncodedRanges(lo, hi)
+	if len(ranges) == 0 {
+		return nil
+	}
+	out := make([]Range, len(ranges))
+	for i, r := range ranges {
+		binary.BigEndian.PutUint64(out[i].Lo[0:8], r.Lo<<shift)
+		binary.BigEndian.PutUint64(out[i].Hi[0:8], r.Hi<<shift|(1<<shift-1))
+		binary.BigEndian.PutUint64(out[i].Hi[8:16], ^uint64(0))
 	}
 	return out
 }
+
+// TimeRanges implements Encoder.TimeRanges.  Times outside the 48-bit
+// millisecond range are clamped to it.
+func (e encoder) TimeRanges(from, to time.Time) ([]Range, error) {
+	if e.totalBits != timestampBits {
+		return nil, fmt.Errorf("%w: totalBits=%d", ErrNoTimestamp, e.totalBits)
+	}
+	lo, hi := clampMillis(from.UnixMilli()), clampMillis(to.UnixMilli())
+	if hi <= lo {
+		return nil, nil
+	}
+	return e.EncodedRanges(lo, hi-1), nil
+}
+
+// clampMillis bounds ms to the unsigned 48-bit timestamp range.
+func clampMillis(ms int64) uint64 {
+	switch {
+	case ms < 0:
+		return 0
+	case ms > 1<<timestampBits-1:
+		return 1<<timestampBits - 1
+	}
+	return uint64(ms)
+}
@@ -1,12 +1,21 @@
 package keyuuid
 
 import (
+	"bytes"
+	"database/sql"
 	"encoding/binary"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/oklog/ulid/v2"
 	"github.com/stretchr/testify/require"
+
+	"github.com/sean-/go-sharded-cluster-keys/encodertest"
+	"github.com/sean-/go-sharded-cluster-keys/internal/memdb"
+	"github.com/sean-/go-sharded-cluster-keys/keysql"
 )
 
 func TestUUIDv7Encoder(t *testing.T) {
@@ -45,6 +54,7 @@ func TestUUIDv7Encoder(t *testing.T) {
 	binary.BigEndian.PutUint64(expPref[0:8], expectedTop)
 	gotPref := enc.Prefix(encU)
 	require.Equal(t, expPref, gotPref)
+	require.Equal(t, rev, enc.PrefixBits(encU))
 }
 
 func TestULIDEncoder(t *testing.T) {
@@ -103,3 +113,474 @@ func TestGenericWrap(t *testing.T) {
 		"sum of sizes should be 128 for identity",
 	)
 }
+
+func TestNewEncoderE(t *testing.T) {
+	tests := []struct {
+		name                              string
+		totalBits, maskOffset, prefixSize int
+		wantErr                           error
+	}{
+		{name: "identity", totalBits: 0, maskOffset: 0, prefixSize: 0},
+		{name: "uuidv7", totalBits: 48, maskOffset: 11, prefixSize: 4},
+		{name: "full-64", totalBits: 64, maskOffset: 0, prefixSize: 64},
+		{name: "negative-offset", totalBits: 48, maskOffset: -1, prefixSize: 4, wantErr: ErrNegativeOffset},
+		{name: "negative-size", totalBits: 48, maskOffset: 11, prefixSize: -4, wantErr: ErrNegativeSize},
+		{name: "negative-total", totalBits: -1, maskOffset: 0, prefixSize: 0, wantErr: ErrNegativeSize},
+		{name: "total-over-64", totalBits: 65, maskOffset: 0, prefixSize: 4, wantErr: ErrLayoutOverflow},
+		{name: "segment-over-total", totalBits: 48, maskOffset: 40, prefixSize: 9, wantErr: ErrLayoutOverflow},
+		{name: "identity-with-prefix", totalBits: 0, maskOffset: 0, prefixSize: 4, wantErr: ErrLayoutOverflow},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			enc, err := NewEncoderE(tc.totalBits, tc.maskOffset, tc.prefixSize)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				require.True(t, strings.HasPrefix(err.Error(), "keyuuid: "), err.Error())
+				require.Nil(t, enc)
+				require.Panics(t, func() { MustNewEncoder(tc.totalBits, tc.maskOffset, tc.prefixSize) })
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.prefixSize, enc.PrefixSize(), "PrefixSize")
+			require.NotPanics(t, func() { MustNewEncoder(tc.totalBits, tc.maskOffset, tc.prefixSize) })
+		})
+	}
+}
+
+func TestNewWrapsAnyUUID(t *testing.T) {
+	u1 := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8") // v1
+	k1 := New(u1)
+	require.Equal(t, u1, k1.UUID())
+	require.Equal(t, u1, k1.Decoded())
+	require.Equal(t, uuid.UUID{}, k1.Prefix())
+	require.Equal(t, u1.String(), k1.String())
+
+	u3 := uuid.MustParse("3d813cbb-47fb-32ba-91df-831e1593ac29") // v3
+	k3 := New(u3)
+	require.Equal(t, u3, k3.UUID())
+
+	// the zero Key behaves like New(uuid.Nil)
+	var zero Key
+	require.Equal(t, uuid.Nil, zero.Decoded())
+	require.Equal(t, uuid.Nil.String(), zero.String())
+}
+
+func TestNewFromUUIDv7(t *testing.T) {
+	u7 := uuid.MustParse("018f14e0-8f0a-7def-91b4-f0ecb69f5f01")
+	k7, err := NewFromUUIDv7(u7)
+	require.NoError(t, err)
+
+	enc := NewUUIDv7Encoder()
+	require.Equal(t, enc.Encode(u7), k7.UUID())
+	require.Equal(t, u7, k7.Decoded())
+	require.Equal(t, enc.Prefix(enc.Encode(u7)), k7.Prefix())
+	require.Equal(t, k7.UUID().String(), k7.String())
+	require.Equal(t, enc, k7.Encoder())
+
+	// wrong version
+	u4 := uuid.MustParse("9b2a4e1c-3f5d-4a8b-9c7e-1d2f3a4b5c6d")
+	_, err = NewFromUUIDv7(u4)
+	require.ErrorIs(t, err, ErrVersion)
+}
+
+func TestNewFromULID(t *testing.T) {
+	u, err := ulid.Parse("01ARYZ6S41TSV4RRFFQ69G5FAV")
+	require.NoError(t, err)
+
+	k, err := NewFromULID(u)
+	require.NoError(t, err)
+	require.Equal(t, uuid.UUID(u), k.Decoded())
+	require.Equal(t, u, ulid.ULID(k.Decoded()))
+	require.Equal(t, NewULIDEncoder().Encode(uuid.UUID(u)), k.UUID())
+}
+
+func TestTimeRanges(t *testing.T) {
+	enc := NewUUIDv7Encoder()
+	from := time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	ranges, err := enc.TimeRanges(from, to)
+	require.NoError(t, err)
+	require.NotEmpty(t, ranges)
+	require.LessOrEqual(t, len(ranges), 1<<enc.PrefixSize())
+
+	inRange := func(u uuid.UUID) bool {
+		for _, r := range ranges {
+			if bytes.Compare(u[:], r.Lo[:]) >= 0 && bytes.Compare(u[:], r.Hi[:]) <= 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i, r := range ranges {
+		require.LessOrEqual(t, bytes.Compare(r.Lo[:], r.Hi[:]), 0)
+		if i > 0 {
+			require.Equal(t, 1, bytes.Compare(r.Lo[:], ranges[i-1].Hi[:]), "ranges must be sorted")
+		}
+	}
+
+	// every UUIDv7 minted inside the window lands in some range; the
+	// instants just outside the window do not.
+	for _, ts := range []time.Time{
+		from, from.Add(time.Millisecond), from.Add(17 * time.Minute), to.Add(-time.Millisecond),
+	} {
+		u, err := uuid.NewV7FromReader(bytes.NewReader(bytes.Repeat([]byte{0xa5}, 16)))
+		require.NoError(t, err)
+		binary.BigEndian.PutUint64(u[0:8], uint64(ts.UnixMilli())<<16|binary.BigEndian.Uint64(u[0:8])&0xffff)
+		require.Truef(t, inRange(enc.Encode(u)), "%s should be covered", ts)
+	}
+	for _, ts := range []time.Time{from.Add(-time.Millisecond), to} {
+		var u uuid.UUID
+		binary.BigEndian.PutUint64(u[0:8], uint64(ts.UnixMilli())<<16)
+		require.Falsef(t, inRange(enc.Encode(u)), "%s should not be covered", ts)
+	}
+
+	empty, err := enc.TimeRanges(to, from)
+	require.NoError(t, err)
+	require.Empty(t, empty)
+
+	_, err = NewEncoder(0, 0, 0).TimeRanges(from, to)
+	require.ErrorIs(t, err, ErrNoTimestamp)
+}
+
+func TestEncodedRangesIdentity(t *testing.T) {
+	ranges := NewEncoder(0, 0, 0).EncodedRanges(1, 2)
+	require.Len(t, ranges, 1)
+	require.Equal(t, uuid.MustParse("00000000-0000-0001-0000-000000000000"), ranges[0].Lo)
+	require.Equal(t, uuid.MustParse("00000000-0000-0002-ffff-ffffffffffff"), ranges[0].Hi)
+}
+
+// constReader is an allocation-free entropy source returning a fixed byte.
+type constReader byte
+
+func (r constReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+func TestUUIDv7Generator(t *testing.T) {
+	now := time.Date(2024, 4, 1, 10, 0, 0, 500_000, time.UTC)
+	g := NewUUIDv7Generator(GeneratorConfig{
+		Now:     func() time.Time { return now },
+		Entropy: constReader(0xff),
+	})
+	enc := NewUUIDv7Encoder()
+
+	var prev uuid.UUID
+	for i := 0; i < 10; i++ {
+		v, err := g.Next()
+		require.NoError(t, err)
+		u := enc.Decode(v)
+		require.Equal(t, uuid.Version(7), u.Version())
+		require.Equal(t, uuid.RFC4122, u.Variant())
+		require.Equal(t, uint64(now.UnixMilli()), binary.BigEndian.Uint64(u[0:8])>>16)
+		// a stalled clock still yields strictly increasing IDs
+		require.Equal(t, 1, bytes.Compare(u[:], prev[:]), "IDs must be strictly increasing")
+		prev = u
+	}
+
+	// a clock that steps backwards keeps IDs increasing
+	now = now.Add(-time.Second)
+	v, err := g.Next()
+	require.NoError(t, err)
+	u := enc.Decode(v)
+	require.Equal(t, 1, bytes.Compare(u[:], prev[:]))
+
+	allocs := testing.AllocsPerRun(100, func() { _, _ = g.Next() })
+	require.Zero(t, allocs, "Next must not allocate")
+}
+
+func TestULIDGenerator(t *testing.T) {
+	now := time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC)
+	g := NewULIDGenerator(GeneratorConfig{
+		Now:     func() time.Time { return now },
+		Entropy: constReader(0x01),
+	})
+	enc := NewULIDEncoder()
+
+	v1, err := g.Next()
+	require.NoError(t, err)
+	v2, err := g.Next()
+	require.NoError(t, err)
+
+	u1, u2 := ulid.ULID(enc.Decode(v1)), ulid.ULID(enc.Decode(v2))
+	require.Equal(t, uint64(now.UnixMilli()), u1.Time())
+	require.Equal(t, uint64(now.UnixMilli()), u2.Time())
+	require.Equal(t, -1, u1.Compare(u2), "same-millisecond ULIDs must increase")
+
+	now = now.Add(time.Millisecond)
+	v3, err := g.Next()
+	require.NoError(t, err)
+	u3 := ulid.ULID(enc.Decode(v3))
+	require.Equal(t, uint64(now.UnixMilli()), u3.Time())
+	require.Equal(t, u1.Entropy(), u3.Entropy(), "a new millisecond redraws entropy")
+
+	// exhaust the entropy within one millisecond
+	g = NewULIDGenerator(GeneratorConfig{
+		Now:     func() time.Time { return now },
+		Entropy: constReader(0xff),
+	})
+	_, err = g.Next()
+	require.NoError(t, err)
+	_, err = g.Next()
+	require.ErrorIs(t, err, ErrMonotonicOverflow)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		now = now.Add(time.Millisecond)
+		_, _ = g.Next()
+	})
+	require.Zero(t, allocs, "Next must not allocate")
+}
+
+func TestGeneratorClockRange(t *testing.T) {
+	for _, now := range []time.Time{
+		time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC),
+		time.UnixMilli(1 << 48),
+	} {
+		cfg := GeneratorConfig{Now: func() time.Time { return now }, Entropy: constReader(0x01)}
+		_, err := NewUUIDv7Generator(cfg).Next()
+		require.ErrorIs(t, err, ErrClockRange, now)
+		_, err = NewULIDGenerator(cfg).Next()
+		require.ErrorIs(t, err, ErrClockRange, now)
+	}
+
+	// the ends of the range are fine
+	for _, now := range []time.Time{time.UnixMilli(0), time.UnixMilli(1<<48 - 1)} {
+		cfg := GeneratorConfig{Now: func() time.Time { return now }, Entropy: constReader(0x01)}
+		v, err := NewULIDGenerator(cfg).Next()
+		require.NoError(t, err)
+		require.Equal(t, uint64(now.UnixMilli()), ulid.ULID(NewULIDEncoder().Decode(v)).Time())
+		_, err = NewUUIDv7Generator(cfg).Next()
+		require.NoError(t, err)
+	}
+
+	// a clock at the epoch is not mistaken for a stall on the first ID
+	epoch := GeneratorConfig{Now: func() time.Time { return time.UnixMilli(0) }, Entropy: constReader(0x01)}
+	v, err := NewULIDGenerator(epoch).Next()
+	require.NoError(t, err)
+	want := [10]byte{0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01, 0x01}
+	require.Equal(t, want[:], ulid.ULID(NewULIDEncoder().Decode(v)).Entropy())
+	v, err = NewUUIDv7Generator(epoch).Next()
+	require.NoError(t, err)
+	u := NewUUIDv7Encoder().Decode(v)
+	require.Zero(t, binary.BigEndian.Uint16(u[6:8])&0xfff, "rand_a of the first ID at the epoch")
+}
+
+func TestSQLRoundTrip(t *testing.T) {
+	db, err := sql.Open(memdb.DriverName, t.Name())
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE keys (s TEXT, b BLOB)")
+	require.NoError(t, err)
+
+	v := NewUUIDv7Encoder().Encode(uuid.MustParse("018f14e0-8f0a-7def-91b4-f0ecb69f5f01"))
+	_, err = db.Exec("INSERT INTO keys VALUES (?, ?)", Column(&v, keysql.Text), Column(&v, keysql.Bytes))
+	require.NoError(t, err)
+
+	var s, b Value
+	require.NoError(t, db.QueryRow("SELECT * FROM keys").Scan(Column(&s, keysql.Text), Column(&b, keysql.Bytes)))
+	require.Equal(t, v, s)
+	require.Equal(t, v, b)
+
+	dv, err := Column(&v, keysql.Bytes).Value()
+	require.NoError(t, err)
+	v[0] ^= 0xff
+	require.Equal(t, b[:], dv, "Value must not alias the column's key")
+
+	_, err = Column(&v, keysql.Int64).Value()
+	require.ErrorIs(t, err, keysql.ErrFormat)
+	require.ErrorIs(t, Column(&v, keysql.Bytes).Scan([]byte{1, 2}), keysql.ErrSourceValue)
+	require.ErrorIs(t, Column(&v, keysql.Text).Scan(nil), keysql.ErrNull)
+}
+
+func TestEncodeAllocs(t *testing.T) {
+	enc := NewUUIDv7Encoder()
+	u := uuid.MustParse("018f14e0-8f0a-7def-91b4-f0ecb69f5f01")
+	require.Zero(t, testing.AllocsPerRun(100, func() {
+		u = enc.Decode(enc.Encode(u))
+		_ = enc.PrefixBits(u)
+	}))
+}
+
+func BenchmarkEncode(b *testing.B) {
+	b.ReportAllocs()
+	enc := NewUUIDv7Encoder()
+	u := uuid.MustParse("018f14e0-8f0a-7def-91b4-f0ecb69f5f01")
+	for i := 0; i < b.N; i++ {
+		u[5] = byte(i)
+		u = enc.Encode(u)
+	}
+	sink = u
+}
+
+func BenchmarkDecode(b *testing.B) {
+	b.ReportAllocs()
+	enc := NewUUIDv7Encoder()
+	u := uuid.MustParse("8018f14e-0f0a-7def-91b4-f0ecb69f5f01")
+	for i := 0; i < b.N; i++ {
+		u[5] = byte(i)
+		u = enc.Decode(u)
+	}
+	sink = u
+}
+
+// sink keeps the compiler from discarding benchmark results.
+var sink Value
+
+func TestEncodeSlice(t *testing.T) {
+	for _, enc := range []Encoder{NewUUIDv7Encoder(), NewEncoder(0, 0, 0)} {
+		src := make([]uuid.UUID, 300)
+		for i := range src {
+			binary.BigEndian.PutUint64(src[i][0:8], uint64(i)*0x9e3779b97f4a7c15)
+			src[i][15] = byte(i)
+		}
+		dst := make([]Value, len(src)+1)
+		enc.EncodeSlice(dst, src)
+		for i, u := range src {
+			require.Equal(t, enc.Encode(u), dst[i])
+		}
+		require.Zero(t, dst[len(src)], "EncodeSlice wrote past len(src)")
+
+		back := make([]uuid.UUID, len(src))
+		enc.DecodeSlice(back, dst[:len(src)])
+		require.Equal(t, src, back)
+
+		require.Panics(t, func() { enc.EncodeSlice(dst[:1], src) })
+		require.Panics(t, func() { enc.DecodeSlice(back[:1], dst) })
+	}
+}
+
+func TestEncodeStream(t *testing.T) {
+	enc := NewUUIDv7Encoder()
+	var in bytes.Buffer
+	src := make([]uuid.UUID, 700)
+	for i := range src {
+		binary.BigEndian.PutUint64(src[i][0:8], uint64(i)*0x9e3779b97f4a7c15)
+		in.Write(src[i][:])
+	}
+
+	var encoded bytes.Buffer
+	n, err := EncodeStream(enc, &encoded, bytes.NewReader(in.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(src)), n)
+	for i, u := range src {
+		want := enc.Encode(u)
+		require.Equal(t, want[:], encoded.Bytes()[i*16:i*16+16])
+	}
+
+	var decoded bytes.Buffer
+	n, err = DecodeStream(enc, &decoded, &encoded)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(src)), n)
+	require.Equal(t, in.Bytes(), decoded.Bytes())
+
+	var out bytes.Buffer
+	n, err = EncodeStream(enc, &out, bytes.NewReader(in.Bytes()[:20]))
+	require.ErrorIs(t, err, ErrPartialWord)
+	require.Equal(t, int64(1), n)
+	require.Equal(t, 16, out.Len())
+}
+
+func BenchmarkEncodeSlice(b *testing.B) {
+	enc := NewUUIDv7Encoder()
+	src := make([]uuid.UUID, 4096)
+	dst := make([]Value, len(src))
+	for i := range src {
+		binary.BigEndian.PutUint64(src[i][0:8], uint64(i)*0x9e3779b97f4a7c15)
+	}
+
+	b.Run("per-value", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(src) * 16))
+		for i := 0; i < b.N; i++ {
+			for j, u := range src {
+				dst[j] = enc.Encode(u)
+			}
+		}
+	})
+	b.Run("slice", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(src) * 16))
+		for i := 0; i < b.N; i++ {
+			enc.EncodeSlice(dst, src)
+		}
+	})
+	b.Run("stream", func(b *testing.B) {
+		in := make([]byte, len(src)*16)
+		b.ReportAllocs()
+		b.SetBytes(int64(len(in)))
+		for i := 0; i < b.N; i++ {
+			if _, err := EncodeStream(enc, io.Discard, bytes.NewReader(in)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestConformance(t *testing.T) {
+	encodertest.RunUUID(t, NewEncoderE)
+}
+
+func FuzzEncoder(f *testing.F) {
+	f.Add(uint8(48), uint8(11), uint8(4), []byte("\x01\x8f\x14\xe0\x8f\x0a\x7d\xef\x91\xb4\xf0\xec\xb6\x9f\x5f\x01"))
+	f.Add(uint8(0), uint8(0), uint8(0), make([]byte, 16))
+	f.Add(uint8(64), uint8(0), uint8(64), bytes.Repeat([]byte{0xff}, 16))
+	f.Fuzz(func(t *testing.T, total, offset, size uint8, b []byte) {
+		if len(b) != 16 {
+			t.Skip()
+		}
+		enc, err := NewEncoderE(int(total), int(offset), int(size))
+		if err != nil {
+			t.Skip()
+		}
+		encodertest.CheckUUIDValue(t, enc, int(total), int(offset), int(size), uuid.UUID(b))
+	})
+}
+
+func TestShardBounds(t *testing.T) {
+	enc := NewUUIDv7Encoder()
+	for p := uint64(0); p < 16; p++ {
+		start, end, err := ShardBounds(enc, p)
+		require.NoError(t, err)
+		require.Len(t, start, 16)
+		if p == 15 {
+			require.Nil(t, end)
+		} else {
+			require.Len(t, end, 16)
+		}
+
+		for i := 0; i < 100; i++ {
+			var u uuid.UUID
+			binary.BigEndian.PutUint64(u[0:8], uint64(i)*0x9e3779b97f4a7c15)
+			v := enc.Encode(u)
+			b := AppendBinary(nil, v)
+			mb, err := v.MarshalBinary()
+			require.NoError(t, err)
+			require.Equal(t, mb, b)
+			inside := bytes.Compare(start, b) <= 0 && (end == nil || bytes.Compare(b, end) < 0)
+			require.Equal(t, enc.PrefixBits(v) == p, inside)
+		}
+	}
+	_, _, err := ShardBounds(enc, 16)
+	require.ErrorIs(t, err, ErrPrefixRange)
+	_, err = ShardPrefix(enc, 1)
+	require.ErrorIs(t, err, ErrUnaligned)
+
+	ulidEnc := NewULIDEncoder()
+	pfx, err := ShardPrefix(ulidEnc, 0xbeef)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xbe, 0xef}, pfx)
+	_, err = ShardPrefix(ulidEnc, 1<<16)
+	require.ErrorIs(t, err, ErrPrefixRange)
+
+	start, end, err := ShardBounds(New(uuid.UUID{}).Encoder(), 0)
+	require.NoError(t, err)
+	require.Equal(t, make([]byte, 16), start)
+	require.Nil(t, end)
+}
@@ -0,0 +1,68 @@
+package keyuuid
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/sean-/go-sharded-cluster-keys/keysql"
+)
+
+// Column returns a driver.Valuer and sql.Scanner that store *v using
+// format f: keysql.Text for the canonical UUID string or keysql.Bytes for
+// the 16 big-endian bytes.  keysql.Int64 cannot hold 128 bits and is
+// rejected.  Value itself is a uuid.UUID and already stores as text.
+func Column(v *Value, f keysql.Format) keysql.Column {
+	return column{v: v, f: f}
+}
+
+type column struct {
+	v *Value
+	f keysql.Format
+}
+
+func (c column) Value() (driver.Value, error) {
+	switch c.f {
+	case keysql.Text:
+		return c.v.String(), nil
+	case keysql.Bytes:
+		// copy so the driver does not alias *v
+		b := *c.v
+		return b[:], nil
+	}
+	return nil, fmt.Errorf("%w: %s for UUID keys", keysql.ErrFormat, c.f)
+}
+
+func (c column) Scan(src any) error {
+	if src == nil {
+		return keysql.ErrNull
+	}
+
+	var u uuid.UUID
+	var err error
+	switch c.f {
+	case keysql.Text:
+		switch x := src.(type) {
+		case string:
+			u, err = uuid.Parse(x)
+		case []byte:
+			u, err = uuid.ParseBytes(x)
+		default:
+			return fmt.Errorf("%w: %T for %s", keysql.ErrSourceType, src, c.f)
+		}
+	case keysql.Bytes:
+		b, ok := src.([]byte)
+		if !ok {
+			return fmt.Errorf("%w: %T for %s", keysql.ErrSourceType, src, c.f)
+		}
+		u, err = uuid.FromBytes(b)
+	default:
+		return fmt.Errorf("%w: %s for UUID keys", keysql.ErrFormat, c.f)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", keysql.ErrSourceValue, err)
+	}
+	*c.v = u
+	return nil
+}
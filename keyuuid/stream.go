@@ -0,0 +1,46 @@
+package keyuuid
+
+import (
+	"io"
+
+	"github.com/google/uuid"
+
+	"github.com/sean-/go-sharded-cluster-keys/internal/wordstream"
+)
+
+// ErrPartialWord is returned by EncodeStream and DecodeStream when the
+// input ends part way through a 16-byte UUID.  It wraps
+// io.ErrUnexpectedEOF.
+var ErrPartialWord = wordstream.ErrPartialWord
+
+// EncodeStream reads raw 16-byte UUIDs from r until EOF, encodes them with
+// enc and writes them to w in the same form.  It returns the number of
+// UUIDs written.
+func EncodeStream(enc Encoder, w io.Writer, r io.Reader) (int64, error) {
+	var src, dst [wordstream.Batch]uuid.UUID
+	return wordstream.Copy(w, r, 16, func(words []byte) {
+		n := len(words) / 16
+		for i := range n {
+			copy(src[i][:], words[i*16:])
+		}
+		enc.EncodeSlice(dst[:n], src[:n])
+		for i := range n {
+			copy(words[i*16:], dst[i][:])
+		}
+	})
+}
+
+// DecodeStream is the inverse of EncodeStream.
+func DecodeStream(enc Encoder, w io.Writer, r io.Reader) (int64, error) {
+	var src, dst [wordstream.Batch]uuid.UUID
+	return wordstream.Copy(w, r, 16, func(words []byte) {
+		n := len(words) / 16
+		for i := range n {
+			copy(src[i][:], words[i*16:])
+		}
+		enc.DecodeSlice(dst[:n], src[:n])
+		for i := range n {
+			copy(words[i*16:], dst[i][:])
+		}
+	})
+}
@@ -0,0 +1,201 @@
+// Package keyversion embeds a layout version in every encoded key, so a
+// cluster can run several encoder layouts side by side during a migration
+// and still decode every key with the layout that produced it.
+//
+// 64-bit keys reserve their lowest VersionBits bits for the version; the
+// shuffled ID sits above them and the shard prefix stays in the top bits.
+// UUID keys overwrite the version nibble, which is restored on decode.
+package keyversion
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+	"github.com/sean-/go-sharded-cluster-keys/keybits"
+)
+
+// Errors returned by the encoders and registries in this package.
+var (
+	ErrVersionBits     = errors.New("keyversion: version bits out of range")
+	ErrVersion         = errors.New("keyversion: version does not fit in the version bits")
+	ErrDuplicate       = errors.New("keyversion: version already registered")
+	ErrUnknownVersion  = errors.New("keyversion: key has an unregistered layout version")
+	ErrVersionMismatch = errors.New("keyversion: key was encoded with a different layout version")
+	ErrNoCurrent       = errors.New("keyversion: no current layout")
+	ErrValueRange      = errors.New("keyversion: value does not fit beside the version bits")
+)
+
+// MaxVersionBits bounds the bits a 64-bit key may reserve for its version.
+const MaxVersionBits = 8
+
+// Encoder64 shard-encodes 64-bit IDs of at most 64-VersionBits bits and
+// tags them with its layout version.
+type Encoder64 struct {
+	version     uint64
+	versionBits int
+	bits        keybits.Encoder[uint64]
+}
+
+// NewEncoder64 returns an Encoder64 for layout version that reserves the
+// low versionBits bits and applies offset and size, as in
+// key64.NewEncoder, to the remaining 64-versionBits bits.
+func NewEncoder64(versionBits int, version uint64, offset, size int) (*Encoder64, error) {
+	if versionBits < 1 || versionBits > MaxVersionBits {
+		return nil, fmt.Errorf("%w: got %d, want [1,%d]", ErrVersionBits, versionBits, MaxVersionBits)
+	}
+	if version >= 1<<versionBits {
+		return nil, fmt.Errorf("%w: version %d, %d bits", ErrVersion, version, versionBits)
+	}
+	bits := keybits.NewEncoderWidth[uint64](64-versionBits, offset, size)
+	if err := bits.Validate(); err != nil {
+		return nil, err
+	}
+	return &Encoder64{version: version, versionBits: versionBits, bits: bits}, nil
+}
+
+// Version returns the layout version e stamps on its keys.
+func (e *Encoder64) Version() uint64 { return e.version }
+
+// VersionBits returns the number of low bits holding the version.
+func (e *Encoder64) VersionBits() int { return e.versionBits }
+
+// LeftSize, PrefixSize and RightSize describe the layout of the ID field
+// as in key64.Encoder.
+func (e *Encoder64) LeftSize() int   { return e.bits.LeftSize() }
+func (e *Encoder64) PrefixSize() int { return e.bits.PrefixSize() }
+func (e *Encoder64) RightSize() int  { return e.bits.RightSize() }
+
+// Encode shard-encodes v and appends the version.  v must fit in
+// 64-VersionBits bits.
+func (e *Encoder64) Encode(v uint64) (key64.Value, error) {
+	if v>>(64-e.versionBits) != 0 {
+		return 0, fmt.Errorf("%w: %#x needs more than %d bits", ErrValueRange, v, 64-e.versionBits)
+	}
+	return key64.Value(e.bits.Encode(v)<<e.versionBits | e.version), nil
+}
+
+// Decode returns the original ID, or ErrVersionMismatch if val carries
+// another version.
+func (e *Encoder64) Decode(val key64.Value) (uint64, error) {
+	if got := VersionOf64(val, e.versionBits); got != e.version {
+		return 0, fmt.Errorf("%w: got %d, want %d", ErrVersionMismatch, got, e.version)
+	}
+	return e.bits.Decode(uint64(val) >> e.versionBits), nil
+}
+
+// Prefix returns the shard prefix of val.
+func (e *Encoder64) Prefix(val key64.Value) uint64 {
+	return e.bits.Prefix(uint64(val) >> e.versionBits)
+}
+
+// VersionOf64 returns the version stored in the low versionBits of val.
+func VersionOf64(val key64.Value, versionBits int) uint64 {
+	return uint64(val) & (1<<versionBits - 1)
+}
+
+// Registry64 holds every layout a cluster may have written, keyed by
+// version.  New keys are encoded with the current layout; any registered
+// layout can be decoded.  It is safe for concurrent use.
+type Registry64 struct {
+	versionBits int
+
+	mu       sync.RWMutex
+	encoders map[uint64]*Encoder64
+	current  *Encoder64
+}
+
+// NewRegistry64 returns an empty Registry64 for keys that reserve
+// versionBits low bits.
+func NewRegistry64(versionBits int) (*Registry64, error) {
+	if versionBits < 1 || versionBits > MaxVersionBits {
+		return nil, fmt.Errorf("%w: got %d, want [1,%d]", ErrVersionBits, versionBits, MaxVersionBits)
+	}
+	return &Registry64{versionBits: versionBits, encoders: make(map[uint64]*Encoder64)}, nil
+}
+
+// Register adds layout version with the given offset and size.  The first
+// registered layout becomes current.
+func (r *Registry64) Register(version uint64, offset, size int) (*Encoder64, error) {
+	e, err := NewEncoder64(r.versionBits, version, offset, size)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.encoders[version]; ok {
+		return nil, fmt.Errorf("%w: %d", ErrDuplicate, version)
+	}
+	r.encoders[version] = e
+	if r.current == nil {
+		r.current = e
+	}
+	return e, nil
+}
+
+// SetCurrent makes version the layout Encode uses.
+func (r *Registry64) SetCurrent(version uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.encoders[version]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	r.current = e
+	return nil
+}
+
+// Current returns the layout Encode uses, or nil if none is registered.
+func (r *Registry64) Current() *Encoder64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// Lookup returns the layout registered as version.
+func (r *Registry64) Lookup(version uint64) (*Encoder64, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.encoders[version]
+	return e, ok
+}
+
+// EncoderFor returns the layout val was encoded with.
+func (r *Registry64) EncoderFor(val key64.Value) (*Encoder64, error) {
+	v := VersionOf64(val, r.versionBits)
+	e, ok := r.Lookup(v)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, v)
+	}
+	return e, nil
+}
+
+// Encode encodes v with the current layout.
+func (r *Registry64) Encode(v uint64) (key64.Value, error) {
+	e := r.Current()
+	if e == nil {
+		return 0, ErrNoCurrent
+	}
+	return e.Encode(v)
+}
+
+// Decode decodes val with the layout its version names.
+func (r *Registry64) Decode(val key64.Value) (uint64, error) {
+	e, err := r.EncoderFor(val)
+	if err != nil {
+		return 0, err
+	}
+	return e.Decode(val)
+}
+
+// Prefix returns the shard prefix of val under the layout its version
+// names.
+func (r *Registry64) Prefix(val key64.Value) (uint64, error) {
+	e, err := r.EncoderFor(val)
+	if err != nil {
+		return 0, err
+	}
+	return e.Prefix(val), nil
+}
@@ -0,0 +1,176 @@
+package keyversion
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+	"github.com/sean-/go-sharded-cluster-keys/keyuuid"
+)
+
+func TestEncoder64(t *testing.T) {
+	e, err := NewEncoder64(2, 1, 11, 13)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), e.Version())
+	require.Equal(t, 2, e.VersionBits())
+	require.Equal(t, 11, e.LeftSize())
+	require.Equal(t, 13, e.PrefixSize())
+	require.Equal(t, 62-24, e.RightSize())
+
+	const id = 0x0123456789ABCDEF
+	val, err := e.Encode(id)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), VersionOf64(val, 2))
+
+	// the prefix is the same segment key64 would pick, still in the top bits
+	require.Equal(t, key64.NewEncoder(11, 13).Prefix(key64.NewEncoder(11, 13).Encode(id)), e.Prefix(val))
+	require.Equal(t, uint64(val)>>51, e.Prefix(val))
+
+	got, err := e.Decode(val)
+	require.NoError(t, err)
+	require.Equal(t, uint64(id), got)
+
+	_, err = e.Decode(val ^ 1)
+	require.ErrorIs(t, err, ErrVersionMismatch)
+	_, err = e.Encode(1 << 62)
+	require.ErrorIs(t, err, ErrValueRange)
+}
+
+func TestNewEncoder64Errors(t *testing.T) {
+	_, err := NewEncoder64(0, 0, 0, 4)
+	require.ErrorIs(t, err, ErrVersionBits)
+	_, err = NewEncoder64(MaxVersionBits+1, 0, 0, 4)
+	require.ErrorIs(t, err, ErrVersionBits)
+	_, err = NewEncoder64(2, 4, 0, 4)
+	require.ErrorIs(t, err, ErrVersion)
+	_, err = NewEncoder64(2, 0, 60, 4)
+	require.ErrorIs(t, err, key64.ErrLayoutOverflow)
+}
+
+func TestRegistry64Migration(t *testing.T) {
+	r, err := NewRegistry64(2)
+	require.NoError(t, err)
+	_, err = r.Encode(1)
+	require.ErrorIs(t, err, ErrNoCurrent)
+
+	v0, err := r.Register(0, 11, 4)
+	require.NoError(t, err)
+	_, err = r.Register(1, 11, 5)
+	require.NoError(t, err)
+	_, err = r.Register(1, 12, 5)
+	require.ErrorIs(t, err, ErrDuplicate)
+	require.Same(t, v0, r.Current())
+
+	ids := []uint64{0, 1, 0x0123456789ABCDEF, 1<<62 - 1}
+	var old, migrated []key64.Value
+	for _, id := range ids {
+		val, err := r.Encode(id)
+		require.NoError(t, err)
+		old = append(old, val)
+	}
+
+	require.ErrorIs(t, r.SetCurrent(3), ErrUnknownVersion)
+	require.NoError(t, r.SetCurrent(1))
+	for _, id := range ids {
+		val, err := r.Encode(id)
+		require.NoError(t, err)
+		migrated = append(migrated, val)
+	}
+
+	// both generations decode side by side
+	for i, id := range ids {
+		got, err := r.Decode(old[i])
+		require.NoError(t, err)
+		require.Equal(t, id, got)
+		got, err = r.Decode(migrated[i])
+		require.NoError(t, err)
+		require.Equal(t, id, got)
+
+		p, err := r.Prefix(migrated[i])
+		require.NoError(t, err)
+		require.Less(t, p, uint64(32))
+	}
+
+	_, err = r.Decode(old[2] | 3)
+	require.ErrorIs(t, err, ErrUnknownVersion)
+	_, err = r.Prefix(old[2] | 3)
+	require.ErrorIs(t, err, ErrUnknownVersion)
+	_, ok := r.Lookup(3)
+	require.False(t, ok)
+
+	_, err = NewRegistry64(0)
+	require.ErrorIs(t, err, ErrVersionBits)
+}
+
+func TestEncoderUUID(t *testing.T) {
+	u := uuid.MustParse("018f14e0-8f0a-7def-91b4-f0ecb69f5f01")
+	e, err := NewEncoderUUID(3, 7, 48, 11, 4)
+	require.NoError(t, err)
+	require.Equal(t, uint8(3), e.Version())
+	require.Equal(t, uint8(7), e.UUIDVersion())
+	require.Equal(t, 4, e.PrefixSize())
+
+	val, err := e.Encode(u)
+	require.NoError(t, err)
+	require.Equal(t, uint8(3), VersionOfUUID(val))
+	plain := keyuuid.NewUUIDv7Encoder().Encode(u)
+	require.Equal(t, plain[:6], val[:6])
+	require.Equal(t, plain[7:], val[7:])
+	require.Equal(t, keyuuid.NewUUIDv7Encoder().PrefixBits(plain), e.PrefixBits(val))
+
+	got, err := e.Decode(val)
+	require.NoError(t, err)
+	require.Equal(t, u, got)
+	require.Equal(t, 7, int(got.Version()))
+
+	_, err = e.Decode(plain)
+	require.ErrorIs(t, err, ErrVersionMismatch)
+	_, err = e.Encode(uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8"))
+	require.ErrorIs(t, err, keyuuid.ErrVersion)
+
+	_, err = NewEncoderUUID(16, 7, 48, 11, 4)
+	require.ErrorIs(t, err, ErrVersion)
+	_, err = NewEncoderUUID(0, 7, 64, 11, 4)
+	require.ErrorIs(t, err, ErrUUIDLayout)
+	_, err = NewEncoderUUID(0, 7, 48, 46, 4)
+	require.ErrorIs(t, err, keyuuid.ErrLayoutOverflow)
+}
+
+func TestRegistryUUIDMigration(t *testing.T) {
+	r := NewRegistryUUID()
+	_, err := r.Encode(uuid.UUID{})
+	require.ErrorIs(t, err, ErrNoCurrent)
+
+	_, err = r.Register(1, 7, 48, 11, 4)
+	require.NoError(t, err)
+	_, err = r.Register(2, 7, 48, 12, 6)
+	require.NoError(t, err)
+	_, err = r.Register(2, 7, 48, 12, 6)
+	require.ErrorIs(t, err, ErrDuplicate)
+
+	u := uuid.MustParse("018f14e0-8f0a-7def-91b4-f0ecb69f5f01")
+	old, err := r.Encode(u)
+	require.NoError(t, err)
+	require.NoError(t, r.SetCurrent(2))
+	require.ErrorIs(t, r.SetCurrent(9), ErrUnknownVersion)
+	require.ErrorIs(t, r.SetCurrent(200), ErrUnknownVersion)
+	migrated, err := r.Encode(u)
+	require.NoError(t, err)
+	require.NotEqual(t, old, migrated)
+
+	for _, val := range []keyuuid.Value{old, migrated} {
+		got, err := r.Decode(val)
+		require.NoError(t, err)
+		require.Equal(t, u, got)
+	}
+	p, err := r.PrefixBits(migrated)
+	require.NoError(t, err)
+	require.Less(t, p, uint64(64))
+
+	_, err = r.Decode(withVersion(old, 9))
+	require.ErrorIs(t, err, ErrUnknownVersion)
+	_, err = r.PrefixBits(withVersion(old, 9))
+	require.ErrorIs(t, err, ErrUnknownVersion)
+}
@@ -0,0 +1,193 @@
+package keyversion
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/sean-/go-sharded-cluster-keys/keyuuid"
+)
+
+// ErrUUIDLayout is returned for UUID layouts whose shuffled field would
+// overlap the version nibble.
+var ErrUUIDLayout = errors.New("keyversion: UUID layouts need totalBits <= 48 to keep the version nibble free")
+
+// MaxUUIDVersion is the largest layout version a UUID key can carry.
+const MaxUUIDVersion = 15
+
+// EncoderUUID shard-encodes UUIDs of one RFC 9562 version and stores its
+// layout version in their version nibble.  The original version is
+// restored on decode, so every input must share it.
+type EncoderUUID struct {
+	version     uint8
+	uuidVersion uint8
+	enc         keyuuid.Encoder
+}
+
+// NewEncoderUUID returns an EncoderUUID for layout version that applies
+// keyuuid.NewEncoder(totalBits, offset, size) to UUIDs of uuidVersion
+// (7 for UUIDv7).
+func NewEncoderUUID(version, uuidVersion uint8, totalBits, offset, size int) (*EncoderUUID, error) {
+	if version > MaxUUIDVersion {
+		return nil, fmt.Errorf("%w: version %d, 4 bits", ErrVersion, version)
+	}
+	if uuidVersion > 15 {
+		return nil, fmt.Errorf("%w: UUID version %d", keyuuid.ErrVersion, uuidVersion)
+	}
+	if totalBits > 48 {
+		return nil, fmt.Errorf("%w: got %d", ErrUUIDLayout, totalBits)
+	}
+	enc, err := keyuuid.NewEncoderE(totalBits, offset, size)
+	if err != nil {
+		return nil, err
+	}
+	return &EncoderUUID{version: version, uuidVersion: uuidVersion, enc: enc}, nil
+}
+
+// Version returns the layout version e stamps on its keys.
+func (e *EncoderUUID) Version() uint8 { return e.version }
+
+// UUIDVersion returns the RFC 9562 version of the UUIDs e accepts.
+func (e *EncoderUUID) UUIDVersion() uint8 { return e.uuidVersion }
+
+// Encoder returns the underlying keyuuid encoder.
+func (e *EncoderUUID) Encoder() keyuuid.Encoder { return e.enc }
+
+// PrefixSize returns the number of bits in the shard prefix.
+func (e *EncoderUUID) PrefixSize() int { return e.enc.PrefixSize() }
+
+// Encode shard-encodes u and replaces its version nibble with the layout
+// version.  It returns keyuuid.ErrVersion if u is not of UUIDVersion.
+func (e *EncoderUUID) Encode(u uuid.UUID) (keyuuid.Value, error) {
+	if got := VersionOfUUID(u); got != e.uuidVersion {
+		return keyuuid.Value{}, fmt.Errorf("%w: got version %d, want %d", keyuuid.ErrVersion, got, e.uuidVersion)
+	}
+	return withVersion(e.enc.Encode(u), e.version), nil
+}
+
+// Decode returns the original UUID, or ErrVersionMismatch if val carries
+// another layout version.
+func (e *EncoderUUID) Decode(val keyuuid.Value) (uuid.UUID, error) {
+	if got := VersionOfUUID(val); got != e.version {
+		return uuid.UUID{}, fmt.Errorf("%w: got %d, want %d", ErrVersionMismatch, got, e.version)
+	}
+	return e.enc.Decode(withVersion(val, e.uuidVersion)), nil
+}
+
+// PrefixBits returns the shard prefix of val as an integer.
+func (e *EncoderUUID) PrefixBits(val keyuuid.Value) uint64 {
+	return e.enc.PrefixBits(val)
+}
+
+// VersionOfUUID returns the version nibble of u: the RFC 9562 version of a
+// plain UUID, or the layout version of an encoded one.
+func VersionOfUUID(u uuid.UUID) uint8 {
+	return u[6] >> 4
+}
+
+func withVersion(u uuid.UUID, v uint8) uuid.UUID {
+	u[6] = u[6]&0x0f | v<<4
+	return u
+}
+
+// RegistryUUID is Registry64 for UUID keys: up to 16 layouts told apart by
+// the version nibble.  It is safe for concurrent use.
+type RegistryUUID struct {
+	mu       sync.RWMutex
+	encoders [MaxUUIDVersion + 1]*EncoderUUID
+	current  *EncoderUUID
+}
+
+// NewRegistryUUID returns an empty RegistryUUID.
+func NewRegistryUUID() *RegistryUUID {
+	return &RegistryUUID{}
+}
+
+// Register adds layout version for UUIDs of uuidVersion with the given
+// keyuuid layout.  The first registered layout becomes current.
+func (r *RegistryUUID) Register(version, uuidVersion uint8, totalBits, offset, size int) (*EncoderUUID, error) {
+	e, err := NewEncoderUUID(version, uuidVersion, totalBits, offset, size)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.encoders[version] != nil {
+		return nil, fmt.Errorf("%w: %d", ErrDuplicate, version)
+	}
+	r.encoders[version] = e
+	if r.current == nil {
+		r.current = e
+	}
+	return e, nil
+}
+
+// SetCurrent makes version the layout Encode uses.
+func (r *RegistryUUID) SetCurrent(version uint8) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if version > MaxUUIDVersion || r.encoders[version] == nil {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	r.current = r.encoders[version]
+	return nil
+}
+
+// Current returns the layout Encode uses, or nil if none is registered.
+func (r *RegistryUUID) Current() *EncoderUUID {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// Lookup returns the layout registered as version.
+func (r *RegistryUUID) Lookup(version uint8) (*EncoderUUID, bool) {
+	if version > MaxUUIDVersion {
+		return nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e := r.encoders[version]
+	return e, e != nil
+}
+
+// EncoderFor returns the layout val was encoded with.
+func (r *RegistryUUID) EncoderFor(val keyuuid.Value) (*EncoderUUID, error) {
+	v := VersionOfUUID(val)
+	e, ok := r.Lookup(v)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, v)
+	}
+	return e, nil
+}
+
+// Encode encodes u with the current layout.
+func (r *RegistryUUID) Encode(u uuid.UUID) (keyuuid.Value, error) {
+	e := r.Current()
+	if e == nil {
+		return keyuuid.Value{}, ErrNoCurrent
+	}
+	return e.Encode(u)
+}
+
+// Decode decodes val with the layout its version nibble names.
+func (r *RegistryUUID) Decode(val keyuuid.Value) (uuid.UUID, error) {
+	e, err := r.EncoderFor(val)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	return e.Decode(val)
+}
+
+// PrefixBits returns the shard prefix of val under the layout its version
+// nibble names.
+func (r *RegistryUUID) PrefixBits(val keyuuid.Value) (uint64, error) {
+	e, err := r.EncoderFor(val)
+	if err != nil {
+		return 0, err
+	}
+	return e.PrefixBits(val), nil
+}
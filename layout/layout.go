@@ -0,0 +1,196 @@
+// Package layout describes encoder layouts, gives them a canonical spec
+// string such as "k64:o11:s13" that can live in config, and recommends one
+// from the shape of a workload: how fast IDs are minted, how often their
+// timestamp ticks and how long writes should stay on one shard before
+// rotating.
+package layout
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"strings"
+	"time"
+)
+
+// Layout is the shape of a key32, key64 or keyuuid encoder.
+type Layout struct {
+	// Width is the key width in bits: 32, 64 or 128 (UUID/ULID).
+	Width int
+	// Total is, for 128-bit keys, the number of top bits holding the
+	// shuffled field (48 for the UUIDv7 and ULID timestamps).  It is
+	// ignored for integer keys.
+	Total int
+	// Offset and Size locate the shard segment, Offset counting from the
+	// least significant bit of the field.
+	Offset, Size int
+}
+
+// FieldBits returns the number of bits the shard segment is taken from:
+// Width for integer keys and Total for 128-bit keys.
+func (l Layout) FieldBits() int {
+	if l.Width == 128 {
+		return l.Total
+	}
+	return l.Width
+}
+
+// WorkloadSpec describes how IDs are generated and how they should spread.
+type WorkloadSpec struct {
+	// Width and Total select the key family, as in Layout.  A zero Total
+	// for 128-bit keys means 48.
+	Width, Total int
+
+	// Rate is the number of IDs minted per second across the cluster.
+	Rate float64
+
+	// Resolution is the tick of the ID's timestamp field, e.g. one
+	// millisecond for UUIDv7 or Snowflake IDs.  Zero means the IDs are a
+	// plain counter that advances once per ID.
+	Resolution time.Duration
+
+	// TimestampOffset is the bit position of the timestamp's (or
+	// counter's) least significant bit within the field: 22 for a
+	// Snowflake ID with 10 worker and 12 sequence bits, 0 for the UUIDv7
+	// and ULID timestamps.
+	TimestampOffset int
+
+	// Shards is the number of shards writes should be spread over.
+	Shards int
+
+	// Rotation is how long writes should stay on one shard before moving
+	// to the next.
+	Rotation time.Duration
+}
+
+// Report explains what a recommended Layout does to a workload.
+type Report struct {
+	// Prefixes is the number of distinct shard prefixes, 2^Size.  It may
+	// exceed the requested shard count, in which case prefixes should be
+	// grouped onto shards with a shardmap.Table.
+	Prefixes int
+
+	// Dwell is how long writes stay on one prefix before rotating.  It is
+	// the requested rotation rounded to a power of two ticks.
+	Dwell time.Duration
+
+	// Cycle is how long it takes to visit every prefix once and come back
+	// to the first.
+	Cycle time.Duration
+
+	// ActiveRate is the write rate of the prefix currently receiving
+	// writes: the whole workload lands on it for Dwell.
+	ActiveRate float64
+
+	// AverageRate is the long-run write rate of each prefix.
+	AverageRate float64
+
+	// WritesPerDwell is the number of writes one prefix absorbs each time
+	// it is active.
+	WritesPerDwell float64
+
+	// Notes explain the choice and flag anything the caller asked for
+	// that could not be met exactly.
+	Notes []string
+}
+
+func (r Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "prefixes: %d\n", r.Prefixes)
+	fmt.Fprintf(&b, "dwell: %s per prefix, cycle: %s\n", r.Dwell, r.Cycle)
+	fmt.Fprintf(&b, "active prefix: %.4g writes/s, %.4g writes per dwell\n", r.ActiveRate, r.WritesPerDwell)
+	fmt.Fprintf(&b, "average per prefix: %.4g writes/s\n", r.AverageRate)
+	for _, n := range r.Notes {
+		fmt.Fprintf(&b, "note: %s\n", n)
+	}
+	return b.String()
+}
+
+// Errors returned by Recommend.
+var (
+	ErrSpec     = errors.New("layout: invalid workload spec")
+	ErrOverflow = errors.New("layout: recommended segment does not fit in the key")
+)
+
+// Recommend proposes an offset and size for spec.  The size is the
+// smallest that gives every shard its own prefix; the offset places the
+// segment just above the bits that change within one rotation interval,
+// so consecutive IDs stay on one shard for about spec.Rotation and then
+// move to the next.
+func Recommend(spec WorkloadSpec) (Layout, Report, error) {
+	l := Layout{Width: spec.Width, Total: spec.Total}
+	switch spec.Width {
+	case 32, 64:
+		l.Total = 0
+	case 128:
+		if l.Total == 0 {
+			l.Total = 48
+		}
+		if l.Total < 0 || l.Total > 64 {
+			return Layout{}, Report{}, fmt.Errorf("%w: total %d outside [0,64]", ErrSpec, l.Total)
+		}
+	default:
+		return Layout{}, Report{}, fmt.Errorf("%w: width must be 32, 64 or 128, got %d", ErrSpec, spec.Width)
+	}
+	switch {
+	case spec.Rate <= 0:
+		return Layout{}, Report{}, fmt.Errorf("%w: rate must be positive", ErrSpec)
+	case spec.Resolution < 0:
+		return Layout{}, Report{}, fmt.Errorf("%w: negative resolution", ErrSpec)
+	case spec.Shards < 1:
+		return Layout{}, Report{}, fmt.Errorf("%w: need at least one shard", ErrSpec)
+	case spec.Rotation <= 0:
+		return Layout{}, Report{}, fmt.Errorf("%w: rotation must be positive", ErrSpec)
+	case spec.TimestampOffset < 0 || spec.TimestampOffset >= l.FieldBits():
+		return Layout{}, Report{}, fmt.Errorf("%w: timestamp offset %d outside the %d-bit field", ErrSpec, spec.TimestampOffset, l.FieldBits())
+	}
+
+	var r Report
+
+	// the time one step of the field's low counter takes
+	tick := spec.Resolution
+	if tick == 0 {
+		tick = time.Duration(float64(time.Second) / spec.Rate)
+		if tick == 0 {
+			tick = 1
+		}
+	}
+
+	// smallest size with a prefix per shard
+	l.Size = bits.Len(uint(spec.Shards - 1))
+	r.Prefixes = 1 << l.Size
+	if r.Prefixes != spec.Shards {
+		r.Notes = append(r.Notes, fmt.Sprintf("%d shards rounded up to %d prefixes; group them with a shardmap.Table", spec.Shards, r.Prefixes))
+	}
+
+	// skip the counter bits that wrap within one rotation: log2 of the
+	// ticks per rotation, rounded to the nearest power of two
+	ticks := float64(spec.Rotation) / float64(tick)
+	skip := 0
+	if ticks >= 1 {
+		skip = int(math.Round(math.Log2(ticks)))
+	} else {
+		r.Notes = append(r.Notes, fmt.Sprintf("rotation %s is shorter than one tick (%s); writes rotate every tick", spec.Rotation, tick))
+	}
+	l.Offset = spec.TimestampOffset + skip
+	if l.Offset+l.Size > l.FieldBits() {
+		return Layout{}, Report{}, fmt.Errorf("%w: offset %d + size %d > %d bits", ErrOverflow, l.Offset, l.Size, l.FieldBits())
+	}
+
+	r.Dwell = tick << skip
+	r.Cycle = r.Dwell * time.Duration(r.Prefixes)
+	r.ActiveRate = spec.Rate
+	r.AverageRate = spec.Rate / float64(r.Prefixes)
+	r.WritesPerDwell = spec.Rate * r.Dwell.Seconds()
+	if r.Dwell != spec.Rotation {
+		r.Notes = append(r.Notes, fmt.Sprintf("rotation %s rounded to %d ticks of %s = %s", spec.Rotation, 1<<skip, tick, r.Dwell))
+	}
+	if spec.Resolution == 0 {
+		r.Notes = append(r.Notes, "counter IDs: dwell assumes the rate stays constant")
+	}
+	if r.WritesPerDwell < 1 {
+		r.Notes = append(r.Notes, "fewer than one write per dwell: consecutive writes scatter across shards")
+	}
+	return l, r, nil
+}
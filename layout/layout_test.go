@@ -0,0 +1,171 @@
+package layout
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sean-/go-sharded-cluster-keys/key32"
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+	"github.com/sean-/go-sharded-cluster-keys/keyuuid"
+)
+
+func TestRecommend(t *testing.T) {
+	testCases := []struct {
+		name   string
+		spec   WorkloadSpec
+		layout Layout
+		dwell  time.Duration
+		notes  int
+	}{
+		{
+			name:   "uuidv7 preset",
+			spec:   WorkloadSpec{Width: 128, Rate: 1000, Resolution: time.Millisecond, Shards: 16, Rotation: 2 * time.Second},
+			layout: Layout{Width: 128, Total: 48, Offset: 11, Size: 4},
+			dwell:  2048 * time.Millisecond,
+			notes:  1,
+		},
+		{
+			name:   "snowflake minute",
+			spec:   WorkloadSpec{Width: 64, Rate: 5000, Resolution: time.Millisecond, TimestampOffset: 22, Shards: 12, Rotation: time.Minute},
+			layout: Layout{Width: 64, Offset: 38, Size: 4},
+			dwell:  65536 * time.Millisecond,
+			notes:  2,
+		},
+		{
+			name:   "counter",
+			spec:   WorkloadSpec{Width: 32, Total: 99, Rate: 1000, Shards: 1024, Rotation: time.Second},
+			layout: Layout{Width: 32, Offset: 10, Size: 10},
+			dwell:  1024 * time.Millisecond,
+			notes:  2,
+		},
+		{
+			name:   "single shard exact rotation",
+			spec:   WorkloadSpec{Width: 64, Rate: 10, Resolution: time.Second, Shards: 1, Rotation: 4 * time.Second},
+			layout: Layout{Width: 64, Offset: 2, Size: 0},
+			dwell:  4 * time.Second,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			l, r, err := Recommend(tc.spec)
+			require.NoError(t, err)
+			require.Equal(t, tc.layout, l)
+			require.Equal(t, 1<<l.Size, r.Prefixes)
+			require.Equal(t, tc.dwell, r.Dwell)
+			require.Equal(t, tc.dwell*time.Duration(r.Prefixes), r.Cycle)
+			require.Equal(t, tc.spec.Rate, r.ActiveRate)
+			require.InDelta(t, tc.spec.Rate/float64(r.Prefixes), r.AverageRate, 1e-9)
+			require.InDelta(t, tc.spec.Rate*tc.dwell.Seconds(), r.WritesPerDwell, 1e-6)
+			require.Len(t, r.Notes, tc.notes, r.Notes)
+		})
+	}
+}
+
+func TestRecommendShortRotation(t *testing.T) {
+	l, r, err := Recommend(WorkloadSpec{Width: 64, Rate: 0.5, Resolution: time.Second, TimestampOffset: 5, Shards: 4, Rotation: time.Millisecond})
+	require.NoError(t, err)
+	require.Equal(t, 5, l.Offset)
+	require.Equal(t, time.Second, r.Dwell)
+	require.Contains(t, r.String(), "shorter than one tick")
+	require.Contains(t, r.String(), "scatter across shards")
+}
+
+func TestRecommendErrors(t *testing.T) {
+	valid := WorkloadSpec{Width: 64, Rate: 1, Resolution: time.Millisecond, Shards: 4, Rotation: time.Second}
+	for name, mutate := range map[string]func(*WorkloadSpec){
+		"width":      func(s *WorkloadSpec) { s.Width = 16 },
+		"total":      func(s *WorkloadSpec) { s.Width, s.Total = 128, 65 },
+		"rate":       func(s *WorkloadSpec) { s.Rate = 0 },
+		"resolution": func(s *WorkloadSpec) { s.Resolution = -1 },
+		"shards":     func(s *WorkloadSpec) { s.Shards = 0 },
+		"rotation":   func(s *WorkloadSpec) { s.Rotation = 0 },
+		"ts offset":  func(s *WorkloadSpec) { s.TimestampOffset = 64 },
+	} {
+		spec := valid
+		mutate(&spec)
+		_, _, err := Recommend(spec)
+		require.ErrorIs(t, err, ErrSpec, name)
+	}
+
+	_, _, err := Recommend(WorkloadSpec{Width: 32, Rate: 1, Resolution: time.Millisecond, TimestampOffset: 22, Shards: 16, Rotation: time.Hour})
+	require.ErrorIs(t, err, ErrOverflow)
+}
+
+func TestParseLayout(t *testing.T) {
+	testCases := []struct {
+		spec   string
+		layout Layout
+	}{
+		{"k32:o11:s13", Layout{Width: 32, Offset: 11, Size: 13}},
+		{"k64:o11:s13", Layout{Width: 64, Offset: 11, Size: 13}},
+		{"k64:o0:s0", Layout{Width: 64}},
+		{"uuid:t48:o11:s4", Layout{Width: 128, Total: 48, Offset: 11, Size: 4}},
+		{"uuid:t48:o16:s16", Layout{Width: 128, Total: 48, Offset: 16, Size: 16}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		l, err := ParseLayout(tc.spec)
+		require.NoError(t, err, tc.spec)
+		require.Equal(t, tc.layout, l)
+		require.Equal(t, tc.spec, l.String())
+
+		text, err := l.MarshalText()
+		require.NoError(t, err)
+		var got Layout
+		require.NoError(t, got.UnmarshalText(text))
+		require.Equal(t, tc.layout, got)
+	}
+
+	for _, spec := range []string{
+		"", "k16:o1:s1", "k64", "k64:o11", "k64:s13:o11", "k64:o11:s13:t48",
+		"k64:o011:s13", "k64:o+1:s13", "k64:o-1:s13", "k64:o:s13", "K64:o11:s13",
+		"uuid:o11:s4", "k64:o11:s13 ",
+	} {
+		_, err := ParseLayout(spec)
+		require.ErrorIs(t, err, ErrSyntax, spec)
+	}
+
+	_, err := ParseLayout("k32:o30:s4")
+	require.ErrorIs(t, err, key32.ErrLayoutOverflow)
+	_, err = ParseLayout("uuid:t65:o0:s4")
+	require.Error(t, err)
+}
+
+func TestBuilders(t *testing.T) {
+	l, err := ParseLayout("k64:o11:s13")
+	require.NoError(t, err)
+	e64, err := l.Key64()
+	require.NoError(t, err)
+	require.Equal(t, key64.MustNewEncoder(11, 13).Encode(0x0123456789ABCDEF), e64.Encode(0x0123456789ABCDEF))
+	_, err = l.Key32()
+	require.ErrorIs(t, err, ErrWidth)
+	_, err = l.UUID()
+	require.ErrorIs(t, err, ErrWidth)
+
+	l, err = ParseLayout("k32:o11:s13")
+	require.NoError(t, err)
+	e32, err := l.Key32()
+	require.NoError(t, err)
+	require.Equal(t, 13, e32.PrefixSize())
+
+	l, err = ParseLayout("uuid:t48:o11:s4")
+	require.NoError(t, err)
+	eu, err := l.UUID()
+	require.NoError(t, err)
+	u := keyuuid.Value{0x01, 0x8f, 0x14, 0xe0, 0x8f, 0x0a, 0x7d, 0xef}
+	require.Equal(t, keyuuid.NewUUIDv7Encoder().Encode(u), eu.Encode(u))
+	_, err = l.Key64()
+	require.ErrorIs(t, err, ErrWidth)
+
+	_, err = Layout{Width: 16}.MarshalText()
+	require.ErrorIs(t, err, ErrWidth)
+
+	// a recommendation round-trips through its spec
+	rec, _, err := Recommend(WorkloadSpec{Width: 128, Rate: 1000, Resolution: time.Millisecond, Shards: 16, Rotation: 2 * time.Second})
+	require.NoError(t, err)
+	require.Equal(t, "uuid:t48:o11:s4", rec.String())
+}
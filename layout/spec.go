@@ -0,0 +1,149 @@
+package layout
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sean-/go-sharded-cluster-keys/key32"
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+	"github.com/sean-/go-sharded-cluster-keys/keyuuid"
+)
+
+// Errors returned by ParseLayout, Validate and the encoder builders.
+var (
+	ErrSyntax = errors.New("layout: invalid layout spec")
+	ErrWidth  = errors.New("layout: wrong key width")
+)
+
+// String returns the canonical spec of l: "k32:o11:s13", "k64:o11:s13" or
+// "uuid:t48:o11:s4".
+func (l Layout) String() string {
+	switch l.Width {
+	case 32, 64:
+		return fmt.Sprintf("k%d:o%d:s%d", l.Width, l.Offset, l.Size)
+	case 128:
+		return fmt.Sprintf("uuid:t%d:o%d:s%d", l.Total, l.Offset, l.Size)
+	}
+	return fmt.Sprintf("Layout(width=%d total=%d offset=%d size=%d)", l.Width, l.Total, l.Offset, l.Size)
+}
+
+// ParseLayout parses a spec in the form Layout.String produces.  Only the
+// canonical form is accepted, so equal layouts always have equal specs.
+// The result is validated.
+func ParseLayout(s string) (Layout, error) {
+	fields := strings.Split(s, ":")
+
+	var l Layout
+	var want string
+	switch fields[0] {
+	case "k32":
+		l.Width, want = 32, "os"
+	case "k64":
+		l.Width, want = 64, "os"
+	case "uuid":
+		l.Width, want = 128, "tos"
+	default:
+		return Layout{}, fmt.Errorf("%w: %q: unknown kind %q (want k32, k64 or uuid)", ErrSyntax, s, fields[0])
+	}
+	if len(fields)-1 != len(want) {
+		return Layout{}, fmt.Errorf("%w: %q: %s takes %d fields", ErrSyntax, s, fields[0], len(want))
+	}
+
+	for i, f := range fields[1:] {
+		n, err := parseField(f, want[i])
+		if err != nil {
+			return Layout{}, fmt.Errorf("%w: %q: %v", ErrSyntax, s, err)
+		}
+		switch want[i] {
+		case 't':
+			l.Total = n
+		case 'o':
+			l.Offset = n
+		case 's':
+			l.Size = n
+		}
+	}
+
+	if err := l.Validate(); err != nil {
+		return Layout{}, err
+	}
+	return l, nil
+}
+
+// parseField parses one "<tag><decimal>" field without sign or leading
+// zeros.
+func parseField(f string, tag byte) (int, error) {
+	if len(f) < 2 || f[0] != tag {
+		return 0, fmt.Errorf("field %q: want %c<number>", f, tag)
+	}
+	digits := f[1:]
+	if digits[0] < '0' || digits[0] > '9' || (digits[0] == '0' && len(digits) > 1) {
+		return 0, fmt.Errorf("field %q: not a canonical number", f)
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil {
+		return 0, fmt.Errorf("field %q: not a canonical number", f)
+	}
+	return n, nil
+}
+
+// Validate reports whether l describes an encoder that can be built.
+func (l Layout) Validate() error {
+	var err error
+	switch l.Width {
+	case 32:
+		_, err = key32.NewEncoderE(l.Offset, l.Size)
+	case 64:
+		_, err = key64.NewEncoderE(l.Offset, l.Size)
+	case 128:
+		_, err = keyuuid.NewEncoderE(l.Total, l.Offset, l.Size)
+	default:
+		return fmt.Errorf("%w: must be 32, 64 or 128, got %d", ErrWidth, l.Width)
+	}
+	return err
+}
+
+// MarshalText implements encoding.TextMarshaler with the canonical spec.
+func (l Layout) MarshalText() ([]byte, error) {
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler via ParseLayout, so a
+// Layout can be read from JSON, YAML, flag.TextVar or the environment.
+func (l *Layout) UnmarshalText(text []byte) error {
+	parsed, err := ParseLayout(string(text))
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+// Key32 builds the key32 encoder l describes.
+func (l Layout) Key32() (key32.Encoder, error) {
+	if l.Width != 32 {
+		return nil, fmt.Errorf("%w: %s is not a 32-bit layout", ErrWidth, l)
+	}
+	return key32.NewEncoderE(l.Offset, l.Size)
+}
+
+// Key64 builds the key64 encoder l describes.
+func (l Layout) Key64() (key64.Encoder, error) {
+	if l.Width != 64 {
+		return nil, fmt.Errorf("%w: %s is not a 64-bit layout", ErrWidth, l)
+	}
+	return key64.NewEncoderE(l.Offset, l.Size)
+}
+
+// UUID builds the keyuuid encoder l describes.
+func (l Layout) UUID() (keyuuid.Encoder, error) {
+	if l.Width != 128 {
+		return nil, fmt.Errorf("%w: %s is not a UUID layout", ErrWidth, l)
+	}
+	return keyuuid.NewEncoderE(l.Total, l.Offset, l.Size)
+}
@@ -0,0 +1,259 @@
+// Package partition maps the shard prefixes produced by key32, key64 and
+// keyuuid encoders onto N message-queue partitions, so events for a key
+// land in the partition that follows the database shard the key lives in.
+//
+// Prefixes are split into N contiguous ranges exactly as shardmap.Even
+// splits them between nodes: partition i owns the prefixes in
+// [floor(i*2^s/N), floor((i+1)*2^s/N)) for an s-bit prefix.  N need not
+// be a power of two, and when N exceeds 2^s some partitions get no keys.
+//
+// # Changing N
+//
+// Partition order always follows prefix order, so changing N only moves
+// range boundaries.  Growing from N to k*N keeps every old boundary:
+// partition i splits into partitions k*i .. k*i+k-1, and each new
+// partition draws its keys from a single old one.  Any other change
+// shifts the boundaries in between; Moves lists exactly which prefixes
+// change partition.  Per-key ordering is only guaranteed within
+// a partition, so drain producers before repartitioning if it matters.
+package partition
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+
+	"github.com/google/uuid"
+
+	"github.com/sean-/go-sharded-cluster-keys/key32"
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+	"github.com/sean-/go-sharded-cluster-keys/keyuuid"
+	"github.com/sean-/go-sharded-cluster-keys/shardmap"
+)
+
+// Errors returned by this package.
+var (
+	ErrPrefixSize = errors.New("partition: prefix size must be in [0,64]")
+	ErrCount      = errors.New("partition: partition count must be positive")
+	ErrKey        = errors.New("partition: key is not an encoded key")
+)
+
+// Partition returns the partition in [0, n) owning prefix, an s-bit shard
+// prefix; bits of prefix above the low size bits are ignored.  It panics
+// if size is outside [0,64] or n is not positive.
+func Partition(prefix uint64, size, n int) int {
+	if size < 0 || size > 64 {
+		panic(fmt.Sprintf("partition: Partition: size=%d", size))
+	}
+	if n <= 0 {
+		panic(fmt.Sprintf("partition: Partition: n=%d", n))
+	}
+	prefix &= maxPrefix(size)
+	// The largest i with floor(i*2^s/n) <= prefix is
+	// floor(((prefix+1)*n - 1) / 2^s), computed in 128 bits.
+	hi, lo := bits.Mul64(prefix, uint64(n))
+	lo, carry := bits.Add64(lo, uint64(n)-1, 0)
+	hi += carry
+	return int(hi<<(64-size) | lo>>size)
+}
+
+// Span is a range of prefixes owned by one partition.
+type Span struct {
+	shardmap.Range
+	Partition int
+}
+
+// Ranges returns, in prefix order, the prefixes each of n partitions owns
+// for an s-bit prefix.  Partitions that own no prefixes are left out.
+func Ranges(size, n int) ([]Span, error) {
+	if size < 0 || size > 64 {
+		return nil, fmt.Errorf("%w: got %d", ErrPrefixSize, size)
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: got %d", ErrCount, n)
+	}
+
+	// Walk the prefixes rather than the partitions: each step covers one
+	// non-empty partition, so there are at most min(n, 2^size) of them.
+	out := make([]Span, 0, min(uint64(n)-1, maxPrefix(size))+1)
+	for first := uint64(0); ; {
+		i := Partition(first, size, n)
+		last := maxPrefix(size)
+		if i+1 < n {
+			last = boundary(uint64(i+1), uint64(n), size) - 1
+		}
+		out = append(out, Span{Range: shardmap.Range{First: first, Last: last}, Partition: i})
+		if last == maxPrefix(size) {
+			return out, nil
+		}
+		first = last + 1
+	}
+}
+
+// maxPrefix returns the largest prefix representable in size bits.
+func maxPrefix(size int) uint64 {
+	return 1<<size - 1
+}
+
+// boundary returns floor(i * 2^size / n) without overflowing; i < n.
+func boundary(i, n uint64, size int) uint64 {
+	q, _ := bits.Div64(i>>(64-size), i<<size, n)
+	return q
+}
+
+// Move is a range of prefixes that changes partition.
+type Move struct {
+	shardmap.Range
+	From, To int
+}
+
+// Moves returns, in prefix order, every range of s-bit prefixes whose
+// partition differs between from and to partitions.
+func Moves(size, from, to int) ([]Move, error) {
+	a, err := Ranges(size, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := Ranges(size, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Move
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		r := shardmap.Range{First: max(a[i].First, b[j].First), Last: min(a[i].Last, b[j].Last)}
+		if a[i].Partition != b[j].Partition {
+			out = append(out, Move{Range: r, From: a[i].Partition, To: b[j].Partition})
+		}
+		if a[i].Last == r.Last {
+			i++
+		}
+		if b[j].Last == r.Last {
+			j++
+		}
+	}
+	return out, nil
+}
+
+// Partitioner assigns message keys to partitions by their shard prefix.
+// A Partitioner is immutable and safe for concurrent use.
+type Partitioner struct {
+	size   int
+	prefix func(key []byte) (uint64, error)
+}
+
+func newPartitioner(size int, prefix func([]byte) (uint64, error)) (*Partitioner, error) {
+	if size < 0 || size > 64 {
+		return nil, fmt.Errorf("%w: got %d", ErrPrefixSize, size)
+	}
+	return &Partitioner{size: size, prefix: prefix}, nil
+}
+
+// NewKey32 returns a Partitioner for keys written by
+// key32.Value.MarshalBinary and encoded with enc.
+func NewKey32(enc key32.Encoder) (*Partitioner, error) {
+	return newPartitioner(enc.PrefixSize(), func(key []byte) (uint64, error) {
+		var v key32.Value
+		if err := v.UnmarshalBinary(key); err != nil {
+			return 0, fmt.Errorf("%w: %w", ErrKey, err)
+		}
+		return uint64(enc.Prefix(v)), nil
+	})
+}
+
+// NewKey64 returns a Partitioner for keys written by
+// key64.Value.MarshalBinary and encoded with enc.
+func NewKey64(enc key64.Encoder) (*Partitioner, error) {
+	return newPartitioner(enc.PrefixSize(), func(key []byte) (uint64, error) {
+		var v key64.Value
+		if err := v.UnmarshalBinary(key); err != nil {
+			return 0, fmt.Errorf("%w: %w", ErrKey, err)
+		}
+		return enc.Prefix(v), nil
+	})
+}
+
+// NewUUID returns a Partitioner for 16-byte keys written by
+// keyuuid.AppendBinary and encoded with enc.
+func NewUUID(enc keyuuid.Encoder) (*Partitioner, error) {
+	return newPartitioner(enc.PrefixSize(), func(key []byte) (uint64, error) {
+		u, err := uuid.FromBytes(key)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %w", ErrKey, err)
+		}
+		return enc.PrefixBits(u), nil
+	})
+}
+
+// PrefixSize returns the prefix width p was built for.
+func (p *Partitioner) PrefixSize() int { return p.size }
+
+// Partition returns the partition in [0, n) for key, or ErrKey if key
+// cannot be read.  It panics if n is not positive.
+func (p *Partitioner) Partition(key []byte, n int) (int, error) {
+	prefix, err := p.prefix(key)
+	if err != nil {
+		return 0, err
+	}
+	return Partition(prefix, p.size, n), nil
+}
+
+// partitionOrHash is Partition for clients that cannot take an error:
+// unreadable keys, including nil ones, are hashed with FNV-1a so they
+// still land consistently.
+func (p *Partitioner) partitionOrHash(key []byte, n int) int {
+	if i, err := p.Partition(key, n); err == nil {
+		return i
+	}
+	h := fnv.New64a()
+	h.Write(key)
+	return int(h.Sum64() % uint64(n))
+}
+
+// RequiresConsistency reports that a key must always reach the same
+// partition, as the sarama and franz-go partitioner interfaces ask.
+func (p *Partitioner) RequiresConsistency() bool { return true }
+
+// Sarama has the shape of sarama.Partitioner.Partition with the message
+// reduced to its encoded key:
+//
+//	func (s saramaPartitioner) Partition(m *sarama.ProducerMessage, n int32) (int32, error) {
+//		key, err := m.Key.Encode()
+//		if err != nil {
+//			return 0, err
+//		}
+//		return s.p.Sarama(key, n)
+//	}
+func (p *Partitioner) Sarama(key []byte, numPartitions int32) (int32, error) {
+	if numPartitions <= 0 {
+		return 0, fmt.Errorf("%w: got %d", ErrCount, numPartitions)
+	}
+	i, err := p.Partition(key, int(numPartitions))
+	return int32(i), err
+}
+
+// KafkaGo has the shape of kafka-go's Balancer.Balance with the message
+// reduced to its key; it picks from the partitions offered, which kafka-go
+// passes in ascending order:
+//
+//	kafka.BalancerFunc(func(m kafka.Message, partitions ...int) int {
+//		return p.KafkaGo(m.Key, partitions...)
+//	})
+//
+// Unreadable keys are hashed.  It panics if partitions is empty.
+func (p *Partitioner) KafkaGo(key []byte, partitions ...int) int {
+	return partitions[p.partitionOrHash(key, len(partitions))]
+}
+
+// FranzGo has the shape of franz-go's kgo.TopicPartitioner.Partition with
+// the record reduced to its key:
+//
+//	func (f franzPartitioner) Partition(r *kgo.Record, n int) int {
+//		return f.p.FranzGo(r.Key, n)
+//	}
+//
+// Unreadable keys are hashed.  It panics if n is not positive.
+func (p *Partitioner) FranzGo(key []byte, n int) int {
+	return p.partitionOrHash(key, n)
+}
@@ -0,0 +1,195 @@
+package partition
+
+import (
+	"math/rand/v2"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sean-/go-sharded-cluster-keys/key32"
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+	"github.com/sean-/go-sharded-cluster-keys/keyuuid"
+	"github.com/sean-/go-sharded-cluster-keys/shardmap"
+)
+
+type sizer int
+
+func (s sizer) PrefixSize() int { return int(s) }
+
+func TestMatchesShardmapEven(t *testing.T) {
+	for _, size := range []int{0, 1, 4, 7} {
+		for _, n := range []int{1, 2, 3, 5, 12, 16, 200} {
+			names := make([]string, n)
+			for i := range names {
+				names[i] = strconv.Itoa(i)
+			}
+
+			spans, err := Ranges(size, n)
+			require.NoError(t, err)
+			if n <= 1<<size {
+				table, err := shardmap.Even(sizer(size), names...)
+				require.NoError(t, err)
+				for p := uint64(0); p < 1<<size; p++ {
+					require.Equal(t, table.Lookup(p), strconv.Itoa(Partition(p, size, n)), "size=%d n=%d p=%d", size, n, p)
+				}
+				require.Len(t, spans, n)
+			}
+
+			// Spans cover every prefix once and agree with Partition.
+			next := uint64(0)
+			for _, s := range spans {
+				require.Equal(t, next, s.First)
+				for p := s.First; p <= s.Last; p++ {
+					require.Equal(t, s.Partition, Partition(p, size, n))
+				}
+				next = s.Last + 1
+			}
+			require.Equal(t, uint64(1)<<size, next)
+		}
+	}
+}
+
+func TestFullWidth(t *testing.T) {
+	require.Equal(t, 0, Partition(0, 64, 7))
+	require.Equal(t, 6, Partition(^uint64(0), 64, 7))
+	require.Equal(t, 2, Partition(1<<63, 64, 4))
+	require.Equal(t, 1, Partition(1<<63-1, 64, 4))
+
+	spans, err := Ranges(64, 3)
+	require.NoError(t, err)
+	require.Equal(t, ^uint64(0), spans[2].Last)
+	for _, s := range spans {
+		require.Equal(t, s.Partition, Partition(s.First, 64, 3))
+		require.Equal(t, s.Partition, Partition(s.Last, 64, 3))
+	}
+}
+
+func TestMoves(t *testing.T) {
+	// Doubling keeps every old boundary: each new partition comes from
+	// exactly one old one.
+	moves, err := Moves(4, 2, 4)
+	require.NoError(t, err)
+	require.Equal(t, []Move{
+		{Range: shardmap.Range{First: 4, Last: 7}, From: 0, To: 1},
+		{Range: shardmap.Range{First: 8, Last: 11}, From: 1, To: 2},
+		{Range: shardmap.Range{First: 12, Last: 15}, From: 1, To: 3},
+	}, moves)
+
+	moves, err = Moves(4, 3, 3)
+	require.NoError(t, err)
+	require.Empty(t, moves)
+
+	// Brute force against Partition for uneven changes.
+	for _, c := range []struct{ from, to int }{{3, 4}, {4, 3}, {5, 7}, {1, 6}, {20, 3}} {
+		moves, err := Moves(4, c.from, c.to)
+		require.NoError(t, err)
+		moved := map[uint64]Move{}
+		for _, m := range moves {
+			for p := m.First; p <= m.Last; p++ {
+				moved[p] = m
+			}
+		}
+		for p := uint64(0); p < 16; p++ {
+			from, to := Partition(p, 4, c.from), Partition(p, 4, c.to)
+			m, ok := moved[p]
+			require.Equal(t, from != to, ok, "%+v p=%d", c, p)
+			if ok {
+				require.Equal(t, from, m.From)
+				require.Equal(t, to, m.To)
+			}
+		}
+	}
+
+	_, err = Moves(4, 0, 3)
+	require.ErrorIs(t, err, ErrCount)
+	_, err = Ranges(65, 3)
+	require.ErrorIs(t, err, ErrPrefixSize)
+}
+
+func TestAdapters(t *testing.T) {
+	enc := key64.NewEncoder(11, 13)
+	p, err := NewKey64(enc)
+	require.NoError(t, err)
+	require.Equal(t, 13, p.PrefixSize())
+	require.True(t, p.RequiresConsistency())
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 1000; i++ {
+		v := enc.Encode(rng.Uint64())
+		key, err := v.MarshalBinary()
+		require.NoError(t, err)
+		want := Partition(enc.Prefix(v), 13, 12)
+
+		got, err := p.Partition(key, 12)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+
+		s, err := p.Sarama(key, 12)
+		require.NoError(t, err)
+		require.Equal(t, int32(want), s)
+
+		require.Equal(t, want, p.FranzGo(key, 12))
+		require.Equal(t, 100+want, p.KafkaGo(key, 100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 110, 111))
+	}
+
+	_, err = p.Sarama([]byte("nope"), 12)
+	require.ErrorIs(t, err, ErrKey)
+	_, err = p.Sarama(nil, 0)
+	require.ErrorIs(t, err, ErrCount)
+
+	// Unreadable keys still land somewhere, consistently.
+	bad := []byte("not a key")
+	require.Equal(t, p.FranzGo(bad, 12), p.FranzGo(bad, 12))
+	require.Less(t, p.FranzGo(bad, 12), 12)
+	require.Contains(t, []int{3, 5}, p.KafkaGo(nil, 3, 5))
+}
+
+func TestConstructors(t *testing.T) {
+	e32 := key32.NewEncoder(8, 4)
+	p32, err := NewKey32(e32)
+	require.NoError(t, err)
+	require.Equal(t, 4, p32.PrefixSize())
+	v32 := e32.Encode(0x12345678)
+	b32, err := v32.MarshalBinary()
+	require.NoError(t, err)
+	got, err := p32.Partition(b32, 16)
+	require.NoError(t, err)
+	require.Equal(t, int(e32.Prefix(v32)), got)
+
+	eu := keyuuid.NewUUIDv7Encoder()
+	pu, err := NewUUID(eu)
+	require.NoError(t, err)
+	u := eu.Encode(uuid.MustParse("018f14e0-8f0a-7def-91b4-f0ecb69f5f01"))
+	got, err = pu.Partition(keyuuid.AppendBinary(nil, u), 16)
+	require.NoError(t, err)
+	require.Equal(t, int(eu.PrefixBits(u)), got)
+
+	_, err = pu.Partition(make([]byte, 15), 16)
+	require.ErrorIs(t, err, ErrKey)
+	_, err = p32.Partition(make([]byte, 8), 16)
+	require.ErrorIs(t, err, ErrKey)
+
+	_, err = newPartitioner(65, nil)
+	require.ErrorIs(t, err, ErrPrefixSize)
+}
+
+func TestPartitionBounds(t *testing.T) {
+	// Bits above the prefix width are ignored, so the result stays < n.
+	require.Equal(t, Partition(3, 2, 3), Partition(0xff, 2, 3))
+	require.Panics(t, func() { Partition(0, -1, 3) })
+	require.Panics(t, func() { Partition(0, 65, 3) })
+	require.Panics(t, func() { Partition(0, 4, 0) })
+
+	// Far more partitions than prefixes costs only one span per prefix.
+	spans, err := Ranges(1, 1<<40)
+	require.NoError(t, err)
+	require.Equal(t, []Span{
+		{Range: shardmap.Range{First: 0, Last: 0}, Partition: 1<<39 - 1},
+		{Range: shardmap.Range{First: 1, Last: 1}, Partition: 1<<40 - 1},
+	}, spans)
+	moves, err := Moves(1, 1<<40, 1<<41)
+	require.NoError(t, err)
+	require.Len(t, moves, 2)
+}
@@ -0,0 +1,264 @@
+// Package reshard plans the data movement needed when a key32 or key64
+// layout changes, such as growing from 2^n to 2^(n+1) shards by widening
+// the prefix, and re-encodes keys from the old layout into the new one.
+package reshard
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/sean-/go-sharded-cluster-keys/key32"
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+)
+
+// Layout is implemented by key32.Encoder and key64.Encoder.
+type Layout interface {
+	LeftSize() int
+	PrefixSize() int
+	EncodedBits() int
+}
+
+// Kind classifies a Move by how its shards fan in and out.
+type Kind int
+
+const (
+	// Keep moves every key of an old shard into exactly one new shard that
+	// receives no other data.
+	Keep Kind = iota
+	// Split moves part of an old shard into one of several new shards.
+	Split
+	// Merge moves an old shard into a new shard that also receives keys
+	// from other old shards.
+	Merge
+	// Reshuffle is both a Split and a Merge.
+	Reshuffle
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Keep:
+		return "keep"
+	case Split:
+		return "split"
+	case Merge:
+		return "merge"
+	case Reshuffle:
+		return "reshuffle"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Range is an inclusive interval [Lo, Hi] of encoded values.
+type Range struct {
+	Lo, Hi uint64
+}
+
+// Move describes the keys that live in old shard From and belong in new
+// shard To once re-encoded.
+//
+// In the old encoding, the moved keys are exactly those k with
+// k&SourceMask == SourceMatch; Contains tests this and SourceRanges lists
+// them as intervals.  Source is their tightest bounding range, and equals
+// the moved keys whenever SourceRanges has a single interval.  After
+// re-encoding, the moved keys all fall inside Dest.
+type Move struct {
+	From, To    uint64
+	Kind        Kind
+	Source      Range
+	SourceMask  uint64
+	SourceMatch uint64
+	Dest        Range
+}
+
+// Contains reports whether the key k, in the old encoding, is one of the
+// keys m moves.
+func (m Move) Contains(k uint64) bool {
+	return k&m.SourceMask == m.SourceMatch
+}
+
+// SourceRanges returns the keys m moves, in the old encoding, as sorted
+// disjoint intervals, or ErrTooManyRanges if that takes more than limit
+// intervals.  A split that takes a bit from the middle of the old key
+// needs one interval per value of the bits above it, so check the count
+// before enumerating.
+func (m Move) SourceRanges(limit int) ([]Range, error) {
+	// Bits below the lowest matched bit are free and contiguous; every
+	// free bit above it doubles the number of intervals.
+	low := bits.TrailingZeros64(m.SourceMask)
+	free := (m.Source.Lo ^ m.Source.Hi) &^ mask(low)
+	if n := bits.OnesCount64(free); n >= 63 || 1<<n > limit {
+		return nil, fmt.Errorf("%w: 2^%d intervals", ErrTooManyRanges, n)
+	}
+
+	var out []Range
+	for sub := uint64(0); ; sub = (sub - free) & free {
+		lo := m.SourceMatch | sub
+		out = append(out, Range{Lo: lo, Hi: lo | mask(low)&m.Source.Hi})
+		if sub == free {
+			break
+		}
+	}
+	return out, nil
+}
+
+// Plan lists every (old shard, new shard) pair that shares keys.
+type Plan struct {
+	OldPrefixSize int
+	NewPrefixSize int
+	// Rewrite is true when the encoded form of keys changes, so every key
+	// must be rewritten with a Reencode function even if it stays put.
+	Rewrite bool
+	Moves   []Move
+}
+
+// Errors returned by New.
+var (
+	ErrWidthMismatch = errors.New("reshard: old and new layouts have different widths")
+	ErrPlanTooLarge  = errors.New("reshard: plan has too many moves")
+	ErrTooManyRanges = errors.New("reshard: move spans too many intervals")
+)
+
+// maxMoveBits caps a plan at 2^maxMoveBits moves.
+const maxMoveBits = 24
+
+// New computes the Plan for moving from layout from to layout to.  Both
+// layouts must have the same width.
+func New(from, to Layout) (*Plan, error) {
+	width := from.EncodedBits()
+	if to.EncodedBits() != width {
+		return nil, fmt.Errorf("%w: %d != %d", ErrWidthMismatch, width, to.EncodedBits())
+	}
+	oOff, oSize := from.LeftSize(), from.PrefixSize()
+	nOff, nSize := to.LeftSize(), to.PrefixSize()
+
+	// Which new prefix bits does knowing the old prefix pin down?
+	known := newPrefix(mask(oSize)<<oOff, nOff, nSize)
+	free := mask(nSize) &^ known
+	if n := oSize + bits.OnesCount64(free); n > maxMoveBits {
+		return nil, fmt.Errorf("%w: 2^%d", ErrPlanTooLarge, n)
+	}
+
+	plan := &Plan{
+		OldPrefixSize: oSize,
+		NewPrefixSize: nSize,
+		Rewrite:       oOff != nOff || oSize != nSize,
+	}
+	fanIn := make(map[uint64]int)
+	for p := uint64(0); ; p++ {
+		fixed := newPrefix(reverse(p, oSize)<<oOff, nOff, nSize)
+		for sub := uint64(0); ; sub = (sub - free) & free {
+			q := fixed | sub
+			m := Move{From: p, To: q, Dest: shardRange(q, nSize, width)}
+			m.SourceMask, m.SourceMatch = sourcePattern(p, q, oOff, oSize, nOff, nSize, width)
+			m.Source = Range{Lo: m.SourceMatch, Hi: m.SourceMatch | (mask(width) &^ m.SourceMask)}
+			plan.Moves = append(plan.Moves, m)
+			fanIn[q]++
+			if sub == free {
+				break
+			}
+		}
+		if p == mask(oSize) {
+			break
+		}
+	}
+
+	fanOut := bits.OnesCount64(free)
+	for i := range plan.Moves {
+		m := &plan.Moves[i]
+		switch split, merge := fanOut > 0, fanIn[m.To] > 1; {
+		case split && merge:
+			m.Kind = Reshuffle
+		case split:
+			m.Kind = Split
+		case merge:
+			m.Kind = Merge
+		}
+	}
+	return plan, nil
+}
+
+// Targets returns the new shards receiving keys from old shard from.
+func (p *Plan) Targets(from uint64) []uint64 {
+	var out []uint64
+	for _, m := range p.Moves {
+		if m.From == from {
+			out = append(out, m.To)
+		}
+	}
+	return out
+}
+
+// Sources returns the old shards feeding new shard to.
+func (p *Plan) Sources(to uint64) []uint64 {
+	var out []uint64
+	for _, m := range p.Moves {
+		if m.To == to {
+			out = append(out, m.From)
+		}
+	}
+	return out
+}
+
+// Reencode64 returns a function converting keys encoded with from into
+// the equivalent keys encoded with to.
+func Reencode64(from, to key64.Encoder) func(key64.Value) key64.Value {
+	return func(v key64.Value) key64.Value {
+		return to.Encode(from.Decode(v))
+	}
+}
+
+// Reencode32 is the key32 counterpart of Reencode64.
+func Reencode32(from, to key32.Encoder) func(key32.Value) key32.Value {
+	return func(v key32.Value) key32.Value {
+		return to.Encode(from.Decode(v))
+	}
+}
+
+// sourcePattern returns the bits that pick out, in the old encoding, the
+// keys of old shard p whose new prefix is q: the old prefix itself, plus
+// wherever the old layout put the original bits the new prefix reads.
+func sourcePattern(p, q uint64, oOff, oSize, nOff, nSize, width int) (keyMask, match uint64) {
+	keyMask = mask(oSize) << (width - oSize)
+	match = p << (width - oSize)
+	for j := 0; j < nSize; j++ {
+		pos := oldPosition(nOff+j, oOff, oSize, width)
+		keyMask |= 1 << pos
+		match |= (q >> (nSize - 1 - j) & 1) << pos
+	}
+	return keyMask, match
+}
+
+// oldPosition returns where a layout at (offset, size) puts bit i of the
+// original value.
+func oldPosition(i, offset, size, width int) int {
+	switch {
+	case i < offset:
+		return i
+	case i < offset+size:
+		return width - 1 - (i - offset)
+	}
+	return i - size
+}
+
+// newPrefix returns the prefix a layout at (offset, size) gives the
+// original value v.
+func newPrefix(v uint64, offset, size int) uint64 {
+	return reverse((v>>offset)&mask(size), size)
+}
+
+// shardRange returns the encoded range of all keys with the given prefix.
+func shardRange(prefix uint64, size, width int) Range {
+	lo := prefix << (width - size)
+	return Range{Lo: lo, Hi: lo | mask(width-size)}
+}
+
+// mask returns a uint64 with the low n bits set.
+func mask(n int) uint64 {
+	return 1<<n - 1
+}
+
+// reverse reverses the low n bits of x.
+func reverse(x uint64, n int) uint64 {
+	return bits.Reverse64(x) >> (64 - n)
+}
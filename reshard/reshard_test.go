@@ -0,0 +1,167 @@
+package reshard
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sean-/go-sharded-cluster-keys/key32"
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+)
+
+func TestSplitDoublesShards(t *testing.T) {
+	plan, err := New(key64.NewEncoder(11, 4), key64.NewEncoder(11, 5))
+	require.NoError(t, err)
+	require.True(t, plan.Rewrite)
+	require.Equal(t, 4, plan.OldPrefixSize)
+	require.Equal(t, 5, plan.NewPrefixSize)
+	require.Len(t, plan.Moves, 32)
+
+	for p := uint64(0); p < 16; p++ {
+		// growing the prefix by one bit splits each shard cleanly in two
+		require.Equal(t, []uint64{2 * p, 2*p + 1}, plan.Targets(p))
+	}
+	for _, m := range plan.Moves {
+		require.Equal(t, Split, m.Kind)
+		// the new prefix bit is original bit 15, which the old layout
+		// keeps at encoded bit 11
+		require.Equal(t, uint64(0xf<<60|1<<11), m.SourceMask)
+		require.Equal(t, m.From<<60|(m.To&1)<<11, m.SourceMatch)
+		require.Equal(t, Range{Lo: m.SourceMatch, Hi: m.From<<60 | (1<<60-1)&^(1<<11) | m.SourceMatch}, m.Source)
+		require.Equal(t, Range{Lo: m.To << 59, Hi: m.To<<59 | (1<<59 - 1)}, m.Dest)
+	}
+}
+
+func TestMergeHalvesShards(t *testing.T) {
+	plan, err := New(key32.NewEncoder(11, 5), key32.NewEncoder(11, 4))
+	require.NoError(t, err)
+	require.Len(t, plan.Moves, 32)
+	for q := uint64(0); q < 16; q++ {
+		require.Equal(t, []uint64{2 * q, 2*q + 1}, plan.Sources(q))
+	}
+	for _, m := range plan.Moves {
+		require.Equal(t, Merge, m.Kind)
+		require.Equal(t, m.To<<28, m.Dest.Lo)
+		require.Equal(t, uint64(1<<28-1), m.Dest.Hi-m.Dest.Lo)
+	}
+}
+
+func TestSameLayoutKeeps(t *testing.T) {
+	plan, err := New(key64.NewEncoder(11, 4), key64.NewEncoder(11, 4))
+	require.NoError(t, err)
+	require.False(t, plan.Rewrite)
+	require.Len(t, plan.Moves, 16)
+	for _, m := range plan.Moves {
+		require.Equal(t, Keep, m.Kind)
+		require.Equal(t, m.From, m.To)
+	}
+}
+
+func TestPlanCoversEveryKey(t *testing.T) {
+	layouts := []struct{ oldOff, oldSize, newOff, newSize int }{
+		{11, 4, 11, 5},
+		{12, 4, 11, 5},
+		{11, 5, 13, 3},
+		{8, 3, 20, 2},
+		{0, 0, 11, 4},
+	}
+	rng := rand.New(rand.NewSource(1))
+
+	for _, l := range layouts {
+		oldEnc := key64.NewEncoder(l.oldOff, l.oldSize)
+		newEnc := key64.NewEncoder(l.newOff, l.newSize)
+		plan, err := New(oldEnc, newEnc)
+		require.NoError(t, err)
+		reencode := Reencode64(oldEnc, newEnc)
+
+		moves := map[[2]uint64]Move{}
+		for _, m := range plan.Moves {
+			moves[[2]uint64{m.From, m.To}] = m
+		}
+
+		for i := 0; i < 1000; i++ {
+			v := rng.Uint64()
+			ov := oldEnc.Encode(v)
+			nv := reencode(ov)
+			require.Equal(t, newEnc.Encode(v), nv)
+
+			m, ok := moves[[2]uint64{oldEnc.Prefix(ov), newEnc.Prefix(nv)}]
+			require.Truef(t, ok, "layout %+v: key %#x has no move", l, v)
+			require.True(t, m.Source.Lo <= uint64(ov) && uint64(ov) <= m.Source.Hi)
+			require.True(t, m.Dest.Lo <= uint64(nv) && uint64(nv) <= m.Dest.Hi)
+
+			// Source picks out only the keys bound for To.
+			for _, other := range plan.Moves {
+				if other.From == m.From {
+					require.Equalf(t, other.To == m.To, other.Contains(uint64(ov)), "layout %+v: key %#x, move %d->%d", l, v, other.From, other.To)
+				}
+			}
+		}
+	}
+}
+
+func TestSourceRanges(t *testing.T) {
+	// Original bit 25 sits below the old field, at encoded bit 25, with
+	// three free left bits above it: eight intervals per move.
+	oldEnc, newEnc := key32.NewEncoder(26, 3), key32.NewEncoder(25, 4)
+	plan, err := New(oldEnc, newEnc)
+	require.NoError(t, err)
+	reencode := Reencode32(oldEnc, newEnc)
+
+	rng := rand.New(rand.NewSource(2))
+	for _, m := range plan.Moves {
+		ranges, err := m.SourceRanges(8)
+		require.NoError(t, err)
+		require.Len(t, ranges, 8)
+		require.Equal(t, m.Source.Lo, ranges[0].Lo)
+		require.Equal(t, m.Source.Hi, ranges[7].Hi)
+		for i := range ranges {
+			require.LessOrEqual(t, ranges[i].Lo, ranges[i].Hi)
+			if i > 0 {
+				require.Less(t, ranges[i-1].Hi+1, ranges[i].Lo, "intervals are disjoint and not adjacent")
+			}
+		}
+
+		for i := 0; i < 200; i++ {
+			k := uint64(rng.Uint32())
+			in := false
+			for _, r := range ranges {
+				in = in || (r.Lo <= k && k <= r.Hi)
+			}
+			require.Equal(t, m.Contains(k), in)
+			if in {
+				nv := reencode(key32.Value(k))
+				require.Equal(t, m.To, uint64(newEnc.Prefix(nv)))
+			}
+		}
+
+		_, err = m.SourceRanges(7)
+		require.ErrorIs(t, err, ErrTooManyRanges)
+	}
+
+	// A merge takes whole old shards: one interval each.
+	plan, err = New(key64.NewEncoder(11, 5), key64.NewEncoder(11, 4))
+	require.NoError(t, err)
+	for _, m := range plan.Moves {
+		ranges, err := m.SourceRanges(1)
+		require.NoError(t, err)
+		require.Equal(t, []Range{{Lo: m.From << 59, Hi: m.From<<59 | (1<<59 - 1)}}, ranges)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	_, err := New(key32.NewEncoder(11, 4), key64.NewEncoder(11, 4))
+	require.ErrorIs(t, err, ErrWidthMismatch)
+
+	_, err = New(key64.NewEncoder(0, 16), key64.NewEncoder(32, 16))
+	require.ErrorIs(t, err, ErrPlanTooLarge)
+}
+
+func TestReencode32(t *testing.T) {
+	oldEnc, newEnc := key32.NewEncoder(4, 3), key32.NewEncoder(3, 4)
+	reencode := Reencode32(oldEnc, newEnc)
+	for _, v := range []uint32{0, 1, 0x12345678, 0xffffffff} {
+		require.Equal(t, newEnc.Encode(v), reencode(oldEnc.Encode(v)))
+	}
+}
@@ -0,0 +1,296 @@
+// Package ring places shard prefixes on weighted nodes by rendezvous
+// (highest random weight) hashing, for clusters whose nodes differ in
+// capacity and so do not fit the power-of-two range splits of shardmap.
+//
+// Each prefix goes to the node with the highest score
+// weight / -ln(hash(node, prefix)).  A node therefore owns a share of the
+// prefixes proportional to its weight, adding a node only takes prefixes
+// from others, and removing one only gives its own prefixes away: no
+// prefix moves between two nodes that both stay.  AddNode and RemoveNode
+// return exactly the prefixes that move, and Diff computes the same for
+// any two shardmap Tables, so ring placement can be compared with range
+// splits directly.
+package ring
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/sean-/go-sharded-cluster-keys/shardmap"
+)
+
+// MaxPrefixSize bounds the prefix width, since a Ring keeps an owner for
+// every prefix.
+const MaxPrefixSize = 20
+
+// Errors returned by this package.
+var (
+	ErrPrefixSize   = errors.New("ring: prefix size out of range")
+	ErrWeight       = errors.New("ring: weight must be positive and finite")
+	ErrDuplicate    = errors.New("ring: node already present")
+	ErrUnknownNode  = errors.New("ring: no such node")
+	ErrNoNodes      = errors.New("ring: no nodes")
+	ErrSizeMismatch = errors.New("ring: tables have different prefix sizes")
+)
+
+// Node is a named node and its relative capacity.
+type Node struct {
+	Name   string
+	Weight float64
+}
+
+// Move is a range of prefixes that changes owner.  From is "" for
+// prefixes that had no owner and To is "" for prefixes left without one.
+type Move struct {
+	shardmap.Range
+	From, To string
+}
+
+// Count returns the number of prefixes moves covers.
+func Count(moves []Move) uint64 {
+	var n uint64
+	for _, m := range moves {
+		n += m.Last - m.First + 1
+	}
+	return n
+}
+
+type member struct {
+	Node
+	seed uint64
+}
+
+// Ring assigns every prefix of one width to a node.  It is safe for
+// concurrent use.
+type Ring struct {
+	mu     sync.RWMutex
+	size   int
+	nodes  []member // sorted by name
+	owners []int32  // index into nodes, or -1
+}
+
+// New returns a Ring for enc's prefix width holding nodes, which may be
+// empty.
+func New(enc shardmap.PrefixSizer, nodes ...Node) (*Ring, error) {
+	size := enc.PrefixSize()
+	if size < 0 || size > MaxPrefixSize {
+		return nil, fmt.Errorf("%w: got %d, want [0,%d]", ErrPrefixSize, size, MaxPrefixSize)
+	}
+	r := &Ring{size: size, owners: make([]int32, 1<<size)}
+	for i := range r.owners {
+		r.owners[i] = -1
+	}
+	for _, n := range nodes {
+		if _, err := r.AddNode(n.Name, n.Weight); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// PrefixSize returns the prefix width r was built for.
+func (r *Ring) PrefixSize() int { return r.size }
+
+// Nodes returns the nodes on r sorted by name.
+func (r *Ring) Nodes() []Node {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Node, len(r.nodes))
+	for i, m := range r.nodes {
+		out[i] = m.Node
+	}
+	return out
+}
+
+// Lookup returns the node owning prefix, or "" if r is empty or prefix
+// does not fit in PrefixSize bits.
+func (r *Ring) Lookup(prefix uint64) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if prefix >= uint64(len(r.owners)) {
+		return ""
+	}
+	return r.name(r.owners[prefix])
+}
+
+// AddNode adds a node and returns the prefixes it takes over, in prefix
+// order.
+func (r *Ring) AddNode(name string, weight float64) ([]Move, error) {
+	if !(weight > 0) || math.IsInf(weight, 1) {
+		return nil, fmt.Errorf("%w: %s has weight %v", ErrWeight, name, weight)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := sort.Search(len(r.nodes), func(i int) bool { return r.nodes[i].Name >= name })
+	if i < len(r.nodes) && r.nodes[i].Name == name {
+		return nil, fmt.Errorf("%w: %s", ErrDuplicate, name)
+	}
+
+	m := member{Node: Node{Name: name, Weight: weight}, seed: seed(name)}
+	r.nodes = append(r.nodes, member{})
+	copy(r.nodes[i+1:], r.nodes[i:])
+	r.nodes[i] = m
+	for p, o := range r.owners {
+		if o >= int32(i) {
+			r.owners[p] = o + 1
+		}
+	}
+
+	var moves []Move
+	for p, o := range r.owners {
+		if o >= 0 && !beats(m, r.nodes[o], uint64(p)) {
+			continue
+		}
+		moves = appendMove(moves, uint64(p), r.name(o), name)
+		r.owners[p] = int32(i)
+	}
+	return moves, nil
+}
+
+// RemoveNode removes a node and returns the prefixes it gives away, in
+// prefix order.
+func (r *Ring) RemoveNode(name string) ([]Move, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := sort.Search(len(r.nodes), func(i int) bool { return r.nodes[i].Name >= name })
+	if i == len(r.nodes) || r.nodes[i].Name != name {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNode, name)
+	}
+	r.nodes = append(r.nodes[:i], r.nodes[i+1:]...)
+
+	var moves []Move
+	for p, o := range r.owners {
+		switch {
+		case o > int32(i):
+			r.owners[p] = o - 1
+		case o == int32(i):
+			r.owners[p] = r.best(uint64(p))
+			moves = appendMove(moves, uint64(p), name, r.name(r.owners[p]))
+		}
+	}
+	return moves, nil
+}
+
+// Assignments returns r's placement as contiguous ranges in prefix order,
+// or nil if r is empty.
+func (r *Ring) Assignments() []shardmap.Assignment {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.nodes) == 0 {
+		return nil
+	}
+	var out []shardmap.Assignment
+	for p, o := range r.owners {
+		name := r.name(o)
+		if n := len(out); n > 0 && out[n-1].Node == name {
+			out[n-1].Last = uint64(p)
+			continue
+		}
+		out = append(out, shardmap.Assignment{Range: shardmap.Range{First: uint64(p), Last: uint64(p)}, Node: name})
+	}
+	return out
+}
+
+// Table returns r's placement as a shardmap Table, or ErrNoNodes if r is
+// empty.
+func (r *Ring) Table() (*shardmap.Table, error) {
+	assigns := r.Assignments()
+	if assigns == nil {
+		return nil, ErrNoNodes
+	}
+	return shardmap.New(sizer(r.size), assigns)
+}
+
+// Diff returns, in prefix order, every range of prefixes whose node
+// differs between before and after.
+func Diff(before, after *shardmap.Table) ([]Move, error) {
+	if before.PrefixSize() != after.PrefixSize() {
+		return nil, fmt.Errorf("%w: %d and %d", ErrSizeMismatch, before.PrefixSize(), after.PrefixSize())
+	}
+	a, b := before.Assignments(), after.Assignments()
+
+	var out []Move
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		rg := shardmap.Range{First: max(a[i].First, b[j].First), Last: min(a[i].Last, b[j].Last)}
+		if a[i].Node != b[j].Node {
+			if n := len(out); n > 0 && out[n-1].From == a[i].Node && out[n-1].To == b[j].Node && out[n-1].Last+1 == rg.First {
+				out[n-1].Last = rg.Last
+			} else {
+				out = append(out, Move{Range: rg, From: a[i].Node, To: b[j].Node})
+			}
+		}
+		if a[i].Last == rg.Last {
+			i++
+		}
+		if b[j].Last == rg.Last {
+			j++
+		}
+	}
+	return out, nil
+}
+
+type sizer int
+
+func (s sizer) PrefixSize() int { return int(s) }
+
+func (r *Ring) name(o int32) string {
+	if o < 0 {
+		return ""
+	}
+	return r.nodes[o].Name
+}
+
+// best returns the index of the highest-scoring node for prefix, or -1.
+func (r *Ring) best(prefix uint64) int32 {
+	best := int32(-1)
+	for i := range r.nodes {
+		if best < 0 || beats(r.nodes[i], r.nodes[best], prefix) {
+			best = int32(i)
+		}
+	}
+	return best
+}
+
+// beats reports whether a outscores b for prefix; ties go to the smaller
+// name so placement never depends on insertion order.
+func beats(a, b member, prefix uint64) bool {
+	sa, sb := score(a, prefix), score(b, prefix)
+	if sa != sb {
+		return sa > sb
+	}
+	return a.Name < b.Name
+}
+
+// score is the weighted rendezvous score weight / -ln(u), with u uniform
+// in (0,1) and derived from the node and prefix.
+func score(m member, prefix uint64) float64 {
+	u := (float64(mix(m.seed^mix(prefix))>>11) + 0.5) / (1 << 53)
+	return m.Weight / -math.Log(u)
+}
+
+func appendMove(moves []Move, prefix uint64, from, to string) []Move {
+	if n := len(moves); n > 0 && moves[n-1].From == from && moves[n-1].To == to && moves[n-1].Last+1 == prefix {
+		moves[n-1].Last = prefix
+		return moves
+	}
+	return append(moves, Move{Range: shardmap.Range{First: prefix, Last: prefix}, From: from, To: to})
+}
+
+func seed(name string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return h.Sum64()
+}
+
+// mix is the splitmix64 finalizer.
+func mix(z uint64) uint64 {
+	z += 0x9e3779b97f4a7c15
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return z ^ z>>31
+}
@@ -0,0 +1,117 @@
+package ring
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+	"github.com/sean-/go-sharded-cluster-keys/shardmap"
+)
+
+func TestWeightedShare(t *testing.T) {
+	r, err := New(key64.NewEncoder(11, 16), Node{"a", 1}, Node{"b", 2}, Node{"c", 1})
+	require.NoError(t, err)
+	require.Equal(t, []Node{{"a", 1}, {"b", 2}, {"c", 1}}, r.Nodes())
+
+	counts := map[string]int{}
+	for p := uint64(0); p < 1<<16; p++ {
+		counts[r.Lookup(p)]++
+	}
+	require.InDelta(t, 1<<14, counts["a"], 1<<14*0.05)
+	require.InDelta(t, 1<<15, counts["b"], 1<<15*0.05)
+	require.InDelta(t, 1<<14, counts["c"], 1<<14*0.05)
+	require.Equal(t, "", r.Lookup(1<<16))
+}
+
+func TestAddRemoveMinimalMovement(t *testing.T) {
+	enc := key64.NewEncoder(11, 12)
+	r, err := New(enc, Node{"a", 1}, Node{"b", 1}, Node{"c", 1})
+	require.NoError(t, err)
+	before, err := r.Table()
+	require.NoError(t, err)
+
+	added, err := r.AddNode("d", 1)
+	require.NoError(t, err)
+	for _, m := range added {
+		require.Equal(t, "d", m.To, "adding only moves prefixes onto the new node")
+	}
+	require.InDelta(t, 1<<10, Count(added), 1<<10*0.15)
+
+	after, err := r.Table()
+	require.NoError(t, err)
+	diff, err := Diff(before, after)
+	require.NoError(t, err)
+	require.Equal(t, added, diff, "moves are exact")
+
+	removed, err := r.RemoveNode("d")
+	require.NoError(t, err)
+	require.Equal(t, Count(added), Count(removed))
+	for i, m := range removed {
+		require.Equal(t, Move{Range: added[i].Range, From: "d", To: added[i].From}, m)
+	}
+	again, err := r.Table()
+	require.NoError(t, err)
+	require.Equal(t, before.Assignments(), again.Assignments(), "removal restores the old placement")
+
+	// Plain range splits move far more: 3 -> 4 even ranges moves about
+	// half the prefixes, against a quarter for the ring.
+	even3, err := shardmap.Even(enc, "a", "b", "c")
+	require.NoError(t, err)
+	even4, err := shardmap.Even(enc, "a", "b", "c", "d")
+	require.NoError(t, err)
+	evenDiff, err := Diff(even3, even4)
+	require.NoError(t, err)
+	require.InDelta(t, 1<<11, Count(evenDiff), 2)
+	require.Less(t, Count(added), Count(evenDiff))
+}
+
+func TestOrderIndependent(t *testing.T) {
+	enc := key64.NewEncoder(0, 10)
+	a, err := New(enc, Node{"x", 1}, Node{"y", 3}, Node{"z", 2})
+	require.NoError(t, err)
+	b, err := New(enc, Node{"z", 2}, Node{"x", 1}, Node{"y", 3})
+	require.NoError(t, err)
+	require.Equal(t, a.Assignments(), b.Assignments())
+}
+
+func TestEmptyRing(t *testing.T) {
+	r, err := New(key64.NewEncoder(0, 2))
+	require.NoError(t, err)
+	require.Equal(t, "", r.Lookup(0))
+	require.Nil(t, r.Assignments())
+	_, err = r.Table()
+	require.ErrorIs(t, err, ErrNoNodes)
+
+	moves, err := r.AddNode("a", 1)
+	require.NoError(t, err)
+	require.Equal(t, []Move{{Range: shardmap.Range{First: 0, Last: 3}, From: "", To: "a"}}, moves)
+
+	moves, err = r.RemoveNode("a")
+	require.NoError(t, err)
+	require.Equal(t, []Move{{Range: shardmap.Range{First: 0, Last: 3}, From: "a", To: ""}}, moves)
+}
+
+func TestErrors(t *testing.T) {
+	_, err := New(key64.NewEncoder(0, MaxPrefixSize+1))
+	require.ErrorIs(t, err, ErrPrefixSize)
+
+	r, err := New(key64.NewEncoder(0, 4), Node{"a", 1})
+	require.NoError(t, err)
+	for _, w := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		_, err = r.AddNode("b", w)
+		require.ErrorIs(t, err, ErrWeight)
+	}
+	_, err = r.AddNode("a", 1)
+	require.ErrorIs(t, err, ErrDuplicate)
+	_, err = r.RemoveNode("b")
+	require.ErrorIs(t, err, ErrUnknownNode)
+
+	other, err := shardmap.Even(key64.NewEncoder(0, 5), "a")
+	require.NoError(t, err)
+	mine, err := r.Table()
+	require.NoError(t, err)
+	_, err = Diff(mine, other)
+	require.ErrorIs(t, err, ErrSizeMismatch)
+}
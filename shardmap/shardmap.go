@@ -0,0 +1,176 @@
+// Package shardmap routes the shard prefixes produced by key32, key64 and
+// keyuuid encoders to named nodes, so every service in a cluster resolves
+// a key to the same destination.
+package shardmap
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+// PrefixSizer is implemented by every key32, key64 and keyuuid Encoder.
+type PrefixSizer interface {
+	PrefixSize() int
+}
+
+// Range is an inclusive interval [First, Last] of shard prefixes.
+type Range struct {
+	First, Last uint64
+}
+
+// Contains reports whether prefix lies in r.
+func (r Range) Contains(prefix uint64) bool {
+	return r.First <= prefix && prefix <= r.Last
+}
+
+// Assignment maps a contiguous range of prefixes to a node.
+type Assignment struct {
+	Range
+	Node string
+}
+
+// Errors returned when building a Table.
+var (
+	ErrPrefixSize   = errors.New("shardmap: prefix size must be in [0,64]")
+	ErrNoNodes      = errors.New("shardmap: no nodes")
+	ErrTooManyNodes = errors.New("shardmap: more nodes than prefixes")
+	ErrCoverage     = errors.New("shardmap: assignments must cover every prefix exactly once")
+)
+
+// Table assigns contiguous prefix ranges to nodes.  A Table is immutable
+// and safe for concurrent use.
+type Table struct {
+	prefixSize int
+	assigns    []Assignment // sorted, contiguous, covering [0, maxPrefix]
+}
+
+// New builds a Table for enc's prefix width from explicit assignments.
+// The assignments may be given in any order but together must cover every
+// prefix in [0, 2^PrefixSize()) exactly once.
+func New(enc PrefixSizer, assignments []Assignment) (*Table, error) {
+	size := enc.PrefixSize()
+	if size < 0 || size > 64 {
+		return nil, fmt.Errorf("%w: got %d", ErrPrefixSize, size)
+	}
+	if len(assignments) == 0 {
+		return nil, ErrNoNodes
+	}
+
+	assigns := append([]Assignment(nil), assignments...)
+	sort.Slice(assigns, func(i, j int) bool { return assigns[i].First < assigns[j].First })
+
+	next, maxPrefix := uint64(0), maxPrefix(size)
+	for i, a := range assigns {
+		switch {
+		case a.First != next:
+			return nil, fmt.Errorf("%w: expected range starting at %d, got [%d,%d]", ErrCoverage, next, a.First, a.Last)
+		case a.Last < a.First || a.Last > maxPrefix:
+			return nil, fmt.Errorf("%w: invalid range [%d,%d]", ErrCoverage, a.First, a.Last)
+		case a.Last == maxPrefix && i != len(assigns)-1:
+			return nil, fmt.Errorf("%w: ranges after [%d,%d]", ErrCoverage, a.First, a.Last)
+		}
+		next = a.Last + 1
+	}
+	if last := assigns[len(assigns)-1].Last; last != maxPrefix {
+		return nil, fmt.Errorf("%w: prefixes above %d are unassigned", ErrCoverage, last)
+	}
+
+	return &Table{prefixSize: size, assigns: assigns}, nil
+}
+
+// Even builds a Table that splits the prefix space of enc into len(nodes)
+// contiguous ranges of as-equal-as-possible size, in the order given.
+func Even(enc PrefixSizer, nodes ...string) (*Table, error) {
+	size := enc.PrefixSize()
+	if size < 0 || size > 64 {
+		return nil, fmt.Errorf("%w: got %d", ErrPrefixSize, size)
+	}
+	n := uint64(len(nodes))
+	if n == 0 {
+		return nil, ErrNoNodes
+	}
+	if size < 64 && n > 1<<size {
+		return nil, fmt.Errorf("%w: %d nodes for %d prefixes", ErrTooManyNodes, n, uint64(1)<<size)
+	}
+
+	assigns := make([]Assignment, n)
+	for i := range assigns {
+		assigns[i].First = boundary(uint64(i), n, size)
+		assigns[i].Node = nodes[i]
+	}
+	for i := range assigns {
+		if i+1 < len(assigns) {
+			assigns[i].Last = assigns[i+1].First - 1
+		} else {
+			assigns[i].Last = maxPrefix(size)
+		}
+	}
+	return New(enc, assigns)
+}
+
+// boundary returns floor(i * 2^size / n) without overflowing; i < n.
+func boundary(i, n uint64, size int) uint64 {
+	q, _ := bits.Div64(i>>(64-size), i<<size, n)
+	return q
+}
+
+// maxPrefix returns the largest prefix representable in size bits.
+func maxPrefix(size int) uint64 {
+	return 1<<size - 1
+}
+
+// PrefixSize returns the prefix width the Table was built for.
+func (t *Table) PrefixSize() int {
+	return t.prefixSize
+}
+
+// Assignments returns a copy of the Table's assignments sorted by prefix.
+func (t *Table) Assignments() []Assignment {
+	return append([]Assignment(nil), t.assigns...)
+}
+
+// Nodes returns the distinct node names in prefix order.
+func (t *Table) Nodes() []string {
+	seen := make(map[string]bool, len(t.assigns))
+	var out []string
+	for _, a := range t.assigns {
+		if !seen[a.Node] {
+			seen[a.Node] = true
+			out = append(out, a.Node)
+		}
+	}
+	return out
+}
+
+// Lookup returns the node owning prefix, or "" if prefix does not fit in
+// PrefixSize bits.
+func (t *Table) Lookup(prefix uint64) string {
+	if prefix > maxPrefix(t.prefixSize) {
+		return ""
+	}
+	i := sort.Search(len(t.assigns), func(i int) bool { return t.assigns[i].Last >= prefix })
+	return t.assigns[i].Node
+}
+
+// Owners returns the assignments overlapping r, clipped to r, in prefix
+// order.  Use it to fan a multi-shard scan out to the right nodes.
+func (t *Table) Owners(r Range) []Assignment {
+	if r.Last > maxPrefix(t.prefixSize) {
+		r.Last = maxPrefix(t.prefixSize)
+	}
+	if r.First > r.Last {
+		return nil
+	}
+
+	var out []Assignment
+	i := sort.Search(len(t.assigns), func(i int) bool { return t.assigns[i].Last >= r.First })
+	for ; i < len(t.assigns) && t.assigns[i].First <= r.Last; i++ {
+		a := t.assigns[i]
+		a.First = max(a.First, r.First)
+		a.Last = min(a.Last, r.Last)
+		out = append(out, a)
+	}
+	return out
+}
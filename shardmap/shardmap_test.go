@@ -0,0 +1,117 @@
+package shardmap
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sean-/go-sharded-cluster-keys/key32"
+	"github.com/sean-/go-sharded-cluster-keys/key64"
+	"github.com/sean-/go-sharded-cluster-keys/keyuuid"
+)
+
+func TestEven(t *testing.T) {
+	tests := []struct {
+		name  string
+		enc   PrefixSizer
+		nodes []string
+		want  []Assignment
+	}{
+		{
+			name:  "key64-4bit-4nodes",
+			enc:   key64.NewEncoder(11, 4),
+			nodes: []string{"a", "b", "c", "d"},
+			want: []Assignment{
+				{Range{0, 3}, "a"}, {Range{4, 7}, "b"}, {Range{8, 11}, "c"}, {Range{12, 15}, "d"},
+			},
+		},
+		{
+			name:  "key32-3bit-3nodes",
+			enc:   key32.NewEncoder(4, 3),
+			nodes: []string{"a", "b", "c"},
+			want:  []Assignment{{Range{0, 1}, "a"}, {Range{2, 4}, "b"}, {Range{5, 7}, "c"}},
+		},
+		{
+			name:  "zero-prefix",
+			enc:   key64.NewEncoder(0, 0),
+			nodes: []string{"only"},
+			want:  []Assignment{{Range{0, 0}, "only"}},
+		},
+		{
+			name:  "full-width",
+			enc:   key64.NewEncoder(0, 64),
+			nodes: []string{"lo", "hi"},
+			want:  []Assignment{{Range{0, math.MaxInt64}, "lo"}, {Range{1 << 63, math.MaxUint64}, "hi"}},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tbl, err := Even(tc.enc, tc.nodes...)
+			require.NoError(t, err)
+			require.Equal(t, tc.enc.PrefixSize(), tbl.PrefixSize())
+			require.Equal(t, tc.want, tbl.Assignments())
+			require.Equal(t, tc.nodes, tbl.Nodes())
+		})
+	}
+
+	_, err := Even(key64.NewEncoder(0, 2), "a", "b", "c", "d", "e")
+	require.ErrorIs(t, err, ErrTooManyNodes)
+	_, err = Even(key64.NewEncoder(0, 2))
+	require.ErrorIs(t, err, ErrNoNodes)
+}
+
+func TestNewValidatesCoverage(t *testing.T) {
+	enc := key64.NewEncoder(11, 2)
+
+	// out of order is fine
+	tbl, err := New(enc, []Assignment{{Range{2, 3}, "b"}, {Range{0, 1}, "a"}})
+	require.NoError(t, err)
+	require.Equal(t, "a", tbl.Lookup(1))
+
+	for name, assigns := range map[string][]Assignment{
+		"gap":      {{Range{0, 0}, "a"}, {Range{2, 3}, "b"}},
+		"overlap":  {{Range{0, 2}, "a"}, {Range{2, 3}, "b"}},
+		"short":    {{Range{0, 2}, "a"}},
+		"too-wide": {{Range{0, 4}, "a"}},
+		"inverted": {{Range{0, 1}, "a"}, {Range{2, 1}, "b"}, {Range{2, 3}, "c"}},
+	} {
+		_, err := New(enc, assigns)
+		require.ErrorIsf(t, err, ErrCoverage, name)
+	}
+}
+
+func TestLookupAndOwners(t *testing.T) {
+	enc := key64.NewEncoder(11, 4)
+	tbl, err := Even(enc, "a", "b", "c", "d")
+	require.NoError(t, err)
+
+	// every encoded key routes to the node owning its prefix
+	for _, v := range []uint64{0, 1 << 11, 5 << 11, 0xdeadbeefcafebabe} {
+		p := enc.Prefix(enc.Encode(v))
+		node := tbl.Lookup(p)
+		require.Equal(t, []string{"a", "b", "c", "d"}[p/4], node)
+	}
+	require.Equal(t, "", tbl.Lookup(16))
+
+	require.Equal(t, []Assignment{{Range{3, 3}, "a"}, {Range{4, 7}, "b"}, {Range{8, 9}, "c"}},
+		tbl.Owners(Range{3, 9}))
+	require.Equal(t, []Assignment{{Range{15, 15}, "d"}}, tbl.Owners(Range{15, math.MaxUint64}))
+	require.Nil(t, tbl.Owners(Range{9, 3}))
+}
+
+func TestLookupUUID(t *testing.T) {
+	enc := keyuuid.NewUUIDv7Encoder()
+	tbl, err := Even(enc, "a", "b")
+	require.NoError(t, err)
+
+	u := enc.Encode(uuid.MustParse("018f14e0-8f0a-7def-91b4-f0ecb69f5f01"))
+	want := "a"
+	if u[0]&0x80 != 0 {
+		want = "b"
+	}
+	require.Equal(t, want, tbl.Lookup(enc.PrefixBits(u)))
+}